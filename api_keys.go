@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+var errInvalidAPIKey = errors.New("Invalid or expired API key")
+
+type apiKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Key is only returned when the key is created.
+	Key string `json:"key,omitempty"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func newAPIKeyResponse(key database.ApiKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.KeyPrefix,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  nullTimePtr(key.ExpiresAt),
+		LastUsedAt: nullTimePtr(key.LastUsedAt),
+		RevokedAt:  nullTimePtr(key.RevokedAt),
+	}
+}
+
+// authenticateAPIKey turns a personal API key into claims carrying the key's
+// scopes.
+func (cfg *apiConfig) authenticateAPIKey(ctx context.Context, apiKey string) (*auth.Claims, error) {
+	key, err := cfg.dbQueries.GetActiveAPIKeyByHash(ctx, auth.HashAPIKey(apiKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.dbQueries.TouchAPIKey(ctx, key.ID)
+	if err != nil {
+		log.Printf("api keys: recording use of %s: %v", key.ID, err)
+	}
+	return &auth.Claims{
+		Scope:    strings.Join(key.Scopes, " "),
+		UserID:   key.UserID,
+		APIKeyID: key.ID,
+	}, nil
+}
+
+func (cfg *apiConfig) createAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	type createBody struct {
+		Name             string   `json:"name"`
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	// Keys do not expire by default, so a leaked key must not be able to
+	// create more of them.
+	if claims.SessionID == uuid.Nil {
+		w.WriteHeader(403)
+		w.Write([]byte("API keys can only be created from a login session"))
+		return
+	}
+
+	r_body := createBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	r_body.Name = strings.TrimSpace(r_body.Name)
+	if r_body.Name == "" || len(r_body.Name) > 100 {
+		w.WriteHeader(400)
+		w.Write([]byte("name must be between 1 and 100 characters"))
+		return
+	}
+	if len(r_body.Scopes) == 0 {
+		w.WriteHeader(400)
+		w.Write([]byte("At least one scope is required"))
+		return
+	}
+	for _, scope := range r_body.Scopes {
+		if !auth.ValidScope(scope) {
+			w.WriteHeader(400)
+			w.Write([]byte("Unknown scope " + scope))
+			return
+		}
+		if !claims.HasScope(scope) {
+			w.WriteHeader(403)
+			w.Write([]byte("Cannot grant the " + scope + " scope"))
+			return
+		}
+	}
+	expiresAt := sql.NullTime{}
+	if r_body.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(r_body.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+
+	apiKey, err := auth.MakeAPIKey()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	key, err := cfg.dbQueries.CreateAPIKey(req.Context(), database.CreateAPIKeyParams{
+		Name:      r_body.Name,
+		KeyPrefix: auth.APIKeyDisplayPrefix(apiKey),
+		KeyHash:   auth.HashAPIKey(apiKey),
+		Scopes:    r_body.Scopes,
+		ExpiresAt: expiresAt,
+		UserID:    claims.UserID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	res_body := newAPIKeyResponse(key)
+	res_body.Key = apiKey
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(201)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) listAPIKeysHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	keys, err := cfg.dbQueries.ListAPIKeys(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []apiKeyResponse{}
+	for _, key := range keys {
+		res_body = append(res_body, newAPIKeyResponse(key))
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) revokeAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	keyID, err := uuid.Parse(req.PathValue("keyID"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid key ID"))
+		return
+	}
+	revoked, err := cfg.dbQueries.RevokeAPIKey(req.Context(), database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if revoked == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("API key not found"))
+		return
+	}
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action:     auditAPIKeyRevoked,
+		ActorID:    userID,
+		TargetType: auditTargetAPIKey,
+		TargetID:   keyID.String(),
+	})
+	w.WriteHeader(204)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// Audit log actions.
+const (
+	auditLogin               = "login"
+	auditLoginFailed         = "login.failed"
+	auditEmailChanged        = "user.email_changed"
+	auditPasswordChanged     = "user.password_changed"
+	auditRefreshTokenRevoked = "refresh_token.revoked"
+	auditSessionRevoked      = "session.revoked"
+	auditAPIKeyRevoked       = "api_key.revoked"
+	auditChirpDeleted        = "chirp.deleted"
+	auditSubscriptionChanged = "subscription.changed"
+	auditRoleChanged         = "admin.role_changed"
+	auditChirpModerated      = "admin.chirp_removed"
+	auditWebhookReplayed     = "admin.webhook_replayed"
+	auditUserSuspended       = "admin.user_suspended"
+	auditUserUnsuspended     = "admin.user_unsuspended"
+	auditUserShadowBanned    = "admin.user_shadow_banned"
+	auditShadowBanLifted     = "admin.user_shadow_ban_lifted"
+	auditReset               = "admin.reset"
+)
+
+// Audit log target types.
+const (
+	auditTargetUser    = "user"
+	auditTargetChirp   = "chirp"
+	auditTargetAPIKey  = "api_key"
+	auditTargetSession = "session"
+	auditTargetWebhook = "webhook_event"
+	auditTargetServer  = "server"
+)
+
+// requestInfo describes the request an audited action happened in.
+type requestInfo struct {
+	ID        string
+	IPAddress string
+	UserAgent string
+}
+
+type requestInfoContextKey struct{}
+
+// validRequestID limits request IDs taken from clients to what is safe to
+// log and echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// middlewareRequestID tags every request with an ID, the client's
+// X-Request-ID if it sent a usable one, and echoes it in the response so log
+// and audit entries can be matched to a request.
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		info := requestInfo{ID: id, IPAddress: clientIP(req), UserAgent: req.UserAgent()}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestInfoContextKey{}, info)))
+	})
+}
+
+// auditEntry is one action to record. Diff maps changed fields to their old
+// and new value, see auditChange; secrets are only ever recorded as changed.
+type auditEntry struct {
+	Action     string
+	ActorID    uuid.UUID
+	TargetType string
+	TargetID   string
+	Diff       map[string]any
+}
+
+// auditChange is the diff of one field.
+func auditChange(old, new any) map[string]any {
+	return map[string]any{"old": old, "new": new}
+}
+
+// recordAudit appends entry to the audit log. The request is taken from ctx;
+// actions the server takes on its own have none. Pass the transaction's
+// queries so the entry is only kept if the action is.
+func recordAudit(ctx context.Context, q *database.Queries, entry auditEntry) error {
+	info, _ := ctx.Value(requestInfoContextKey{}).(requestInfo)
+	if entry.Diff == nil {
+		entry.Diff = map[string]any{}
+	}
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+	return q.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+		Action:     entry.Action,
+		ActorID:    uuid.NullUUID{UUID: entry.ActorID, Valid: entry.ActorID != uuid.Nil},
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IpAddress:  info.IPAddress,
+		UserAgent:  info.UserAgent,
+		RequestID:  info.ID,
+		Diff:       diff,
+	})
+}
+
+// recordAuditBestEffort records entry for actions that already happened
+// outside a transaction, logging instead of failing the request.
+func (cfg *apiConfig) recordAuditBestEffort(ctx context.Context, entry auditEntry) {
+	err := recordAudit(ctx, cfg.dbQueries, entry)
+	if err != nil {
+		log.Printf("audit: recording %s on %s %s: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// auditChirpRemoval keeps the content of a deleted chirp in the audit log.
+func auditChirpRemoval(db_chirp database.Chirp) map[string]any {
+	return map[string]any{
+		"author_id": db_chirp.UserID,
+		"body":      auditChange(db_chirp.Body, nil),
+	}
+}
+
+// auditOtherSessionsRevoked records that a user logged out everywhere but
+// in session.
+func auditOtherSessionsRevoked(userID, session uuid.UUID, revoked int64) auditEntry {
+	return auditEntry{
+		Action:     auditSessionRevoked,
+		ActorID:    userID,
+		TargetType: auditTargetUser,
+		TargetID:   userID.String(),
+		Diff:       map[string]any{"kept_session_id": session, "revoked_tokens": revoked},
+	}
+}
+
+type auditLogResponse struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Action     string          `json:"action"`
+	ActorID    *uuid.UUID      `json:"actor_id"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IPAddress  string          `json:"ip_address"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Diff       json.RawMessage `json:"diff"`
+}
+
+// listAuditLogHandler pages through the audit log, newest first. Filters:
+// actor_id, action, target_type, target_id, since and until (RFC 3339);
+// before takes the id of the last entry of the previous page.
+func (cfg *apiConfig) listAuditLogHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	badRequest := func(msg string) {
+		w.WriteHeader(400)
+		w.Write([]byte(msg))
+	}
+
+	params := database.ListAuditLogParams{RowLimit: 100}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			badRequest("limit must be between 1 and 1000")
+			return
+		}
+		params.RowLimit = int32(limit)
+	}
+	if value := query.Get("actor_id"); value != "" {
+		actorID, err := uuid.Parse(value)
+		if err != nil {
+			badRequest("Invalid actor_id")
+			return
+		}
+		params.ActorID = uuid.NullUUID{UUID: actorID, Valid: true}
+	}
+	nullString := func(name string) sql.NullString {
+		value := query.Get(name)
+		return sql.NullString{String: value, Valid: value != ""}
+	}
+	params.Action = nullString("action")
+	params.TargetType = nullString("target_type")
+	params.TargetID = nullString("target_id")
+	nullTime := func(name string) (sql.NullTime, bool) {
+		value := query.Get(name)
+		if value == "" {
+			return sql.NullTime{}, true
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			badRequest("Invalid " + name + ", expected RFC 3339")
+			return sql.NullTime{}, false
+		}
+		return sql.NullTime{Time: parsed.UTC(), Valid: true}, true
+	}
+	var ok bool
+	if params.Since, ok = nullTime("since"); !ok {
+		return
+	}
+	if params.Until, ok = nullTime("until"); !ok {
+		return
+	}
+	if value := query.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			badRequest("Invalid before")
+			return
+		}
+		params.Before = sql.NullInt64{Int64: before, Valid: true}
+	}
+
+	entries, err := cfg.dbQueries.ListAuditLog(req.Context(), params)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []auditLogResponse{}
+	for _, entry := range entries {
+		res := auditLogResponse{
+			ID:         entry.ID,
+			CreatedAt:  entry.CreatedAt,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			IPAddress:  entry.IpAddress,
+			UserAgent:  entry.UserAgent,
+			RequestID:  entry.RequestID,
+			Diff:       entry.Diff,
+		}
+		if entry.ActorID.Valid {
+			res.ActorID = &entry.ActorID.UUID
+		}
+		res_body = append(res_body, res)
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// relationTarget authenticates the request and parses the userID path value
+// of the user to block or mute, which has to exist. It writes the error
+// response itself.
+func (cfg *apiConfig) relationTarget(w http.ResponseWriter, req *http.Request) (userID, targetID uuid.UUID, ok bool) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return uuid.Nil, uuid.Nil, false
+	}
+	targetID, err = uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	if targetID == userID {
+		w.WriteHeader(400)
+		w.Write([]byte("You cannot do this to yourself"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	_, err = cfg.dbQueries.GetUserByID(req.Context(), targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not load user"))
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, targetID, true
+}
+
+// blockedEitherWay reports whether one of the users blocked the other.
+func (cfg *apiConfig) blockedEitherWay(ctx context.Context, userID, otherID uuid.UUID) (bool, error) {
+	return cfg.dbQueries.IsBlocked(ctx, database.IsBlockedParams{
+		UserID:  userID,
+		OtherID: otherID,
+	})
+}
+
+// blockUserHandler hides the two users from each other. Both stop following
+// the other, and neither can follow the other again until the block is
+// lifted.
+func (cfg *apiConfig) blockUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, blockedID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+
+	err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		_, err := q.CreateBlock(req.Context(), database.CreateBlockParams{
+			BlockerID: userID,
+			BlockedID: blockedID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.DeleteFollow(req.Context(), database.DeleteFollowParams{
+			FollowerID: userID,
+			FolloweeID: blockedID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.DeleteFollow(req.Context(), database.DeleteFollowParams{
+			FollowerID: blockedID,
+			FolloweeID: userID,
+		})
+		return err
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not block user"))
+		return
+	}
+	cfg.relationsChanged(userID, blockedID)
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unblockUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, blockedID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteBlock(req.Context(), database.DeleteBlockParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	cfg.relationsChanged(userID, blockedID)
+	w.WriteHeader(204)
+}
+
+// muteUserHandler hides a user from the caller's timeline and notifications.
+// Unlike a block the muted user does not notice.
+func (cfg *apiConfig) muteUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, mutedID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	_, err := cfg.dbQueries.CreateMute(req.Context(), database.CreateMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not mute user"))
+		return
+	}
+	cfg.relationsChanged(userID)
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unmuteUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, mutedID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteMute(req.Context(), database.DeleteMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	cfg.relationsChanged(userID)
+	w.WriteHeader(204)
+}
+
+type relationResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) listBlocksHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	blocks, err := cfg.dbQueries.ListBlocks(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []relationResponse{}
+	for _, block := range blocks {
+		res_body = append(res_body, relationResponse{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) listMutesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	mutes, err := cfg.dbQueries.ListMutes(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []relationResponse{}
+	for _, mute := range mutes {
+		res_body = append(res_body, relationResponse{UserID: mute.MutedID, CreatedAt: mute.CreatedAt})
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
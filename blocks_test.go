@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestFollowBlockedUser(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	blocker := createTestUser(t, cfg, auth.RoleUser)
+	blocked := createTestUser(t, cfg, auth.RoleUser)
+
+	rec := serve(mux, "POST", "/api/users/"+blocked.ID.String()+"/block", blocker.token, "")
+	if rec.Code != 204 {
+		t.Fatalf("Expected block to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(mux, "POST", "/api/users/"+blocker.ID.String()+"/follow", blocked.token, "")
+	if rec.Code != 403 {
+		t.Errorf("Expected the blocked user to be refused, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "POST", "/api/users/"+blocked.ID.String()+"/follow", blocker.token, "")
+	if rec.Code != 403 {
+		t.Errorf("Expected the blocker to be refused, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBlockUnknownUser(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	blocker := createTestUser(t, cfg, auth.RoleUser)
+
+	rec := serve(mux, "POST", "/api/users/"+uuid.NewString()+"/block", blocker.token, "")
+	if rec.Code != 404 || rec.Body.String() != "User not found" {
+		t.Errorf("Expected 404 User not found, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+// chirpInteractionPayload is the payload of the like and rechirp events.
+type chirpInteractionPayload struct {
+	ChirpID  uuid.UUID `json:"chirp_id"`
+	AuthorID uuid.UUID `json:"author_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// interactionTarget authenticates the request and loads the chirpID path
+// value chirp, which the caller has to be able to see. It writes the error
+// response itself.
+func (cfg *apiConfig) interactionTarget(w http.ResponseWriter, req *http.Request) (userID uuid.UUID, chirp database.Chirp, ok bool) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return uuid.Nil, database.Chirp{}, false
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("Chirp not found"))
+		return uuid.Nil, database.Chirp{}, false
+	}
+	chirp, err = cfg.dbQueries.GetVisibleChirp(req.Context(), database.GetVisibleChirpParams{
+		ID:       chirpID,
+		ViewerID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		w.Write([]byte("Chirp not found"))
+		return uuid.Nil, database.Chirp{}, false
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not load chirp"))
+		return uuid.Nil, database.Chirp{}, false
+	}
+	return userID, chirp, true
+}
+
+// interact stores a like or rechirp with create and records eventType for it,
+// unless the caller already did the same before.
+func (cfg *apiConfig) interact(w http.ResponseWriter, req *http.Request, eventType string, create func(q *database.Queries, chirpID, userID uuid.UUID) (int64, error)) {
+	userID, chirp, ok := cfg.interactionTarget(w, req)
+	if !ok {
+		return
+	}
+	err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		created, err := create(q, chirp.ID, userID)
+		if err != nil || created == 0 {
+			return err
+		}
+		return recordEvent(req.Context(), q, eventType, chirp.ID, chirpInteractionPayload{
+			ChirpID:  chirp.ID,
+			AuthorID: chirp.UserID,
+			UserID:   userID,
+		})
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not save"))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// undoInteraction removes a like or rechirp with remove. It does not check
+// whether the caller can still see the chirp, so a block never leaves a like
+// behind that cannot be taken back.
+func (cfg *apiConfig) undoInteraction(w http.ResponseWriter, req *http.Request, remove func(chirpID, userID uuid.UUID) (int64, error)) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("Chirp not found"))
+		return
+	}
+	deleted, err := remove(chirpID, userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not save"))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) likeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.interact(w, req, events.ChirpLiked, func(q *database.Queries, chirpID, userID uuid.UUID) (int64, error) {
+		return q.CreateChirpLike(req.Context(), database.CreateChirpLikeParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) unlikeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.undoInteraction(w, req, func(chirpID, userID uuid.UUID) (int64, error) {
+		return cfg.dbQueries.DeleteChirpLike(req.Context(), database.DeleteChirpLikeParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) rechirpHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.interact(w, req, events.ChirpRechirped, func(q *database.Queries, chirpID, userID uuid.UUID) (int64, error) {
+		return q.CreateRechirp(req.Context(), database.CreateRechirpParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) undoRechirpHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.undoInteraction(w, req, func(chirpID, userID uuid.UUID) (int64, error) {
+		return cfg.dbQueries.DeleteRechirp(req.Context(), database.DeleteRechirpParams{
+			ChirpID: chirpID,
+			UserID:  userID,
+		})
+	})
+}
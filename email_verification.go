@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailNotVerified = errors.New("verify your email address first")
+
+// validEmail reports whether email is a bare address such as
+// user@example.com, without display name or comments.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// newMailerFromEnv picks the mail transport from MAILER. Without an explicit
+// choice SMTP is used when SMTP_HOST is set. Only in development mails are
+// otherwise written to MAIL_DIR so local setups can read them, anywhere else
+// a missing mail setup stops the server.
+func newMailerFromEnv(platform string) mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	kind := os.Getenv("MAILER")
+	if kind == "" && os.Getenv("SMTP_HOST") != "" {
+		kind = "smtp"
+	}
+	switch kind {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "memory":
+		return &mailer.MemoryMailer{}
+	case "file":
+	case "":
+		if platform != "dev" {
+			log.Fatalf("No mailer configured, set MAILER or SMTP_HOST")
+		}
+	default:
+		log.Fatalf("Unknown MAILER %q", kind)
+	}
+	// Not below the working directory, /app/ serves that.
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "chirpy-mail")
+	}
+	return &mailer.FileMailer{Dir: dir, From: from}
+}
+
+// sendVerificationEmail issues a single use token for the user's current
+// email address and mails it. Only the token's signature is stored.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.dbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token, cfg.secretKey),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Welcome to Chirpy!\n\n"+
+			"Confirm your email address by sending the token below to POST /api/users/verify:\n\n%s\n\n"+
+			"The token expires in %v. If you did not sign up, ignore this mail.\n",
+			token, emailVerificationTTL),
+	})
+}
+
+// requireVerifiedEmail returns errEmailNotVerified when the config demands
+// verified addresses and the user has not confirmed theirs.
+func (cfg *apiConfig) requireVerifiedEmail(ctx context.Context, userID uuid.UUID) error {
+	if !cfg.requireEmailVerification {
+		return nil
+	}
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerifiedAt.Valid {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+func (cfg *apiConfig) verifyEmailHandler(w http.ResponseWriter, req *http.Request) {
+	type verifyBody struct {
+		Token string `json:"token"`
+	}
+
+	r_body := verifyBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil || r_body.Token == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("token is required"))
+		return
+	}
+
+	var verified int64
+	var userID uuid.UUID
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		used, err := q.UseEmailVerificationToken(req.Context(), auth.HashToken(r_body.Token, cfg.secretKey))
+		if err != nil {
+			return err
+		}
+		userID = used.UserID
+		// The address may have changed since the token was sent, in which
+		// case nothing is verified.
+		verified, err = q.VerifyUserEmail(req.Context(), database.VerifyUserEmailParams{
+			ID:    used.UserID,
+			Email: used.Email,
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid or expired token"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if verified == 0 {
+		w.WriteHeader(409)
+		w.Write([]byte("Token does not match the current email address or it is already verified"))
+		return
+	}
+	db_user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err == nil {
+		cfg.bootstrapAdmin(req.Context(), db_user)
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) resendVerificationHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		w.WriteHeader(409)
+		w.Write([]byte("Email address is already verified"))
+		return
+	}
+	err = cfg.sendVerificationEmail(req.Context(), user)
+	if err != nil {
+		log.Printf("email verification: sending to user %s: %v", user.ID, err)
+		w.WriteHeader(502)
+		w.Write([]byte("Failed to send verification email"))
+		return
+	}
+	w.WriteHeader(202)
+}
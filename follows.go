@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+// Follow statuses. Follows of private users stay pending until the followee
+// approves them.
+const (
+	followPending  = "pending"
+	followApproved = "approved"
+)
+
+type followEventPayload struct {
+	FollowerID uuid.UUID `json:"follower_id"`
+	FolloweeID uuid.UUID `json:"followee_id"`
+}
+
+func (cfg *apiConfig) followUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	followeeID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if followeeID == userID {
+		w.WriteHeader(400)
+		w.Write([]byte("You cannot follow yourself"))
+		return
+	}
+	blocked, err := cfg.blockedEitherWay(req.Context(), userID, followeeID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if blocked {
+		w.WriteHeader(403)
+		w.Write([]byte("You cannot follow this user"))
+		return
+	}
+
+	followee, err := cfg.dbQueries.GetUserByID(req.Context(), followeeID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	status := followApproved
+	eventType := events.UserFollowed
+	if followee.IsPrivate {
+		status = followPending
+		eventType = events.FollowRequested
+	}
+
+	created := int64(0)
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		created, err = q.CreateFollow(req.Context(), database.CreateFollowParams{
+			FollowerID: userID,
+			FolloweeID: followeeID,
+			Status:     status,
+		})
+		if err != nil || created == 0 {
+			return err
+		}
+		return recordEvent(req.Context(), q, eventType, followeeID, followEventPayload{
+			FollowerID: userID,
+			FolloweeID: followeeID,
+		})
+	})
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if created > 0 && status == followApproved {
+		cfg.relationsChanged(userID)
+	}
+	if created > 0 && status == followPending {
+		response_json, _ := json.Marshal(map[string]string{"status": status})
+		w.WriteHeader(202)
+		w.Write(response_json)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unfollowUserHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	followeeID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteFollow(req.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	cfg.relationsChanged(userID)
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) listFollowRequestsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	requests, err := cfg.dbQueries.ListFollowRequests(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []relationResponse{}
+	for _, request := range requests {
+		res_body = append(res_body, relationResponse{UserID: request.FollowerID, CreatedAt: request.CreatedAt})
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) approveFollowRequestHandler(w http.ResponseWriter, req *http.Request) {
+	userID, followerID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	approved := int64(0)
+	err := cfg.withTx(req.Context(), func(q *database.Queries) error {
+		var err error
+		approved, err = q.ApproveFollowRequest(req.Context(), database.ApproveFollowRequestParams{
+			FollowerID: followerID,
+			FolloweeID: userID,
+		})
+		if err != nil || approved == 0 {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.FollowApproved, userID, followEventPayload{
+			FollowerID: followerID,
+			FolloweeID: userID,
+		})
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if approved == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("Follow request not found"))
+		return
+	}
+	cfg.relationsChanged(followerID)
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) denyFollowRequestHandler(w http.ResponseWriter, req *http.Request) {
+	userID, followerID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	denied, err := cfg.dbQueries.DenyFollowRequest(req.Context(), database.DenyFollowRequestParams{
+		FollowerID: followerID,
+		FolloweeID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if denied == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("Follow request not found"))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// updatePrivacyHandler makes the caller's account private or public. Going
+// public approves every pending follow request.
+func (cfg *apiConfig) updatePrivacyHandler(w http.ResponseWriter, req *http.Request) {
+	type privacyBody struct {
+		IsPrivate bool `json:"is_private"`
+	}
+
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	r_body := privacyBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		err := q.SetUserPrivate(req.Context(), database.SetUserPrivateParams{
+			ID:        userID,
+			IsPrivate: r_body.IsPrivate,
+		})
+		if err != nil || r_body.IsPrivate {
+			return err
+		}
+		followers, err := q.ApproveAllFollowRequests(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		for _, followerID := range followers {
+			err = recordEvent(req.Context(), q, events.FollowApproved, userID, followEventPayload{
+				FollowerID: followerID,
+				FolloweeID: userID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	response_json, _ := json.Marshal(privacyBody{IsPrivate: r_body.IsPrivate})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
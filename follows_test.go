@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+)
+
+func TestPrivateChirpHiddenFromNonFollowers(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	author := createTestUser(t, cfg, auth.RoleUser)
+	viewer := createTestUser(t, cfg, auth.RoleUser)
+	chirp := createTestChirp(t, cfg, author)
+	path := "/api/chirps/" + chirp.ID.String()
+
+	rec := serve(mux, "PUT", "/api/users/privacy", author.token, `{"is_private":true}`)
+	if rec.Code != 200 {
+		t.Fatalf("Expected privacy update to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(mux, "GET", path, viewer.token, "")
+	if rec.Code != 404 {
+		t.Errorf("Expected 404 for a non-follower, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "GET", path, author.token, "")
+	if rec.Code != 200 {
+		t.Errorf("Expected the author to see the chirp, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(mux, "POST", "/api/users/"+author.ID.String()+"/follow", viewer.token, "")
+	if rec.Code != 202 {
+		t.Fatalf("Expected a follow request, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "GET", path, viewer.token, "")
+	if rec.Code != 404 {
+		t.Errorf("Expected 404 while the request is pending, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(mux, "POST", "/api/users/follow-requests/"+viewer.ID.String()+"/approve", author.token, "")
+	if rec.Code != 204 {
+		t.Fatalf("Expected approval to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "GET", path, viewer.token, "")
+	if rec.Code != 200 {
+		t.Errorf("Expected an approved follower to see the chirp, got %d: %s", rec.Code, rec.Body)
+	}
+}
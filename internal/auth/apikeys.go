@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every personal API key so leaked keys are easy to
+// recognise, e.g. by secret scanners.
+const APIKeyPrefix = "chirpy_"
+
+// MakeAPIKey returns a new random personal API key.
+func MakeAPIKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(key), nil
+}
+
+// HashAPIKey returns the SHA-256 hex digest an API key is stored and looked
+// up by.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyDisplayPrefix returns the part of key that is stored in the clear to
+// tell keys apart in listings.
+func APIKeyDisplayPrefix(key string) string {
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) < len(APIKeyPrefix)+6 {
+		return ""
+	}
+	return key[:len(APIKeyPrefix)+6]
+}
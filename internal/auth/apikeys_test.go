@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMakeAPIKey(t *testing.T) {
+	key, err := MakeAPIKey()
+	if err != nil {
+		t.Fatal("failed to create key:", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) != len(APIKeyPrefix)+64 {
+		t.Errorf("Unexpected key format: %v", key)
+	}
+	other, _ := MakeAPIKey()
+	if HashAPIKey(key) == HashAPIKey(other) {
+		t.Errorf("Expected different keys to hash differently")
+	}
+	if prefix := APIKeyDisplayPrefix(key); prefix != key[:len(APIKeyPrefix)+6] {
+		t.Errorf("Unexpected display prefix: %v", prefix)
+	}
+
+	header := http.Header{}
+	header.Add("Authorization", "ApiKey "+key)
+	got, err := GetAPIKey(header)
+	if err != nil || got != key {
+		t.Errorf("Expected key %v from header, got %v (%v)", key, got, err)
+	}
+}
@@ -1,69 +1,38 @@
 package auth
 
 import(
-    "golang.org/x/crypto/bcrypt"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"time"
 	"github.com/google/uuid"
 	"net/http"
 	"strings"
 	"crypto/rand"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
+// HashPassword hashes password with DefaultPasswordHasher.
 func HashPassword(password string) (string, error){
-	hashed_password, err := bcrypt.GenerateFromPassword([]byte(password),10)
-	if err != nil{
-		return  "",fmt.Errorf("failed to encrypt password - aborting")
-	}
-	err = bcrypt.CompareHashAndPassword(hashed_password,[]byte(password))
-	if err != nil{
-		return  "",fmt.Errorf("Encountered unknown fault when encrypting the password!")
-	}
-
-	return string(hashed_password), nil
+	return DefaultPasswordHasher.Hash(password)
 }
 
+// CheckPasswordHash verifies password against hash of any supported
+// algorithm.
 func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash),[]byte(password))
-	if err != nil{
-		return  fmt.Errorf("Incorrect password")
-	}
-	return nil
+	_, err := DefaultPasswordHasher.Verify(password, hash)
+	return err
 } 
 
+// MakeJWT creates an HS256 access token signed with tokenSecret.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error){
-	new_token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		jwt.RegisteredClaims{
-			Issuer: "chirpy",
-			IssuedAt: jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-			Subject: userID.String(),
-		})
-	ss, err := new_token.SignedString([]byte(tokenSecret))
-	return ss, err
-
+	return NewHMACKeySet(tokenSecret).MakeJWT(userID, expiresIn)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error){
-	
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil{
-		return  uuid.UUID{},err
-	}
-	userIDStr, err := token.Claims.GetSubject()
-	if err != nil{
-		return  uuid.UUID{},err
-	}
-	userIDUUID, err := uuid.Parse(userIDStr)
-	if err != nil{
-		return  uuid.UUID{},err
-	}
-	return userIDUUID,nil
+// ValidateJWT checks an HS256 token signed with tokenSecret, including its
+// issuer and audience, and returns its claims.
+func ValidateJWT(tokenString, tokenSecret string) (*Claims, error){
+	return NewHMACKeySet(tokenSecret).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string,error){
@@ -83,6 +52,30 @@ func MakeRefreshToken() (string,error){
 	return key_string, nil
 }
 
+// HashRefreshToken returns the SHA-256 hex digest a refresh token is stored
+// and looked up by.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenPrefix returns the part of a refresh token that is stored in the
+// clear to tell tokens apart.
+func RefreshTokenPrefix(token string) string {
+	if len(token) < 8 {
+		return token
+	}
+	return token[:8]
+}
+
+// HashToken signs an opaque token with tokenSecret so only the signature has
+// to be stored; a leaked table does not reveal usable tokens.
+func HashToken(token, tokenSecret string) string {
+	mac := hmac.New(sha256.New, []byte(tokenSecret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	keyString := "ApiKey"
 	apiToken, err := GetAuthKey(headers,keyString)
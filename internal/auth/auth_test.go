@@ -22,12 +22,12 @@ func TestValidateJWT(t *testing.T) {
         }
 
         // Validate the token
-        gotUserID, err := ValidateJWT(token, secret)
+        claims, err := ValidateJWT(token, secret)
         if err != nil {
             t.Fatal("failed to validate token:", err)
         }
-		if gotUserID != userID {
-			t.Errorf("Expected ID %v, got %v", userID, gotUserID)
+		if claims.UserID != userID {
+			t.Errorf("Expected ID %v, got %v", userID, claims.UserID)
 		}
 
     })
@@ -62,6 +62,32 @@ func TestValidateJWT(t *testing.T) {
     })
 }
 
+func TestClaims(t *testing.T) {
+    userID := uuid.New()
+    sessionID := uuid.New()
+    keys := NewHMACKeySet("your-test-secret")
+
+    token, err := keys.Sign(NewClaims(userID, sessionID, []string{ScopeChirpsWrite}, time.Hour))
+    if err != nil {
+        t.Fatal("failed to create token:", err)
+    }
+    claims, err := keys.ValidateJWT(token)
+    if err != nil {
+        t.Fatal("failed to validate token:", err)
+    }
+    if claims.UserID != userID || claims.SessionID != sessionID {
+        t.Errorf("Unexpected IDs: user %v session %v", claims.UserID, claims.SessionID)
+    }
+    if !claims.HasScope(ScopeChirpsWrite) || claims.HasScope(ScopeChirpsDelete) {
+        t.Errorf("Unexpected scopes: %v", claims.Scopes())
+    }
+
+    plain, _ := MakeJWT(userID, "your-test-secret", time.Hour)
+    claims, err = ValidateJWT(plain, "your-test-secret")
+    if err != nil || claims.SessionID != uuid.Nil || len(claims.Scopes()) != 0 {
+        t.Errorf("Expected a plain token without session and scopes, got %+v (%v)", claims, err)
+    }
+}
 
 func TestBearerToken(t *testing.T) {
     // Create a test UUID and secret
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Scopes an access token can carry.
+const (
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeChirpsDelete = "chirps:delete"
+	ScopeUsersRead    = "users:read"
+	ScopeUsersWrite   = "users:write"
+	ScopeAdmin        = "admin"
+)
+
+// UserScopes are granted to a user logging in with their credentials.
+var UserScopes = []string{ScopeChirpsWrite, ScopeChirpsDelete, ScopeUsersRead, ScopeUsersWrite}
+
+// Roles a user can have. Moderators may moderate content, admins may do
+// everything else on the /admin API as well.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// ValidRole reports whether role is one Chirpy knows.
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// ScopesForRole returns the scopes granted to a user with role logging in.
+// Moderators and admins also get ScopeAdmin to reach the /admin API, where
+// their current role decides what they may do.
+func ScopesForRole(role string) []string {
+	if role == RoleModerator || role == RoleAdmin {
+		return append(slices.Clone(UserScopes), ScopeAdmin)
+	}
+	return UserScopes
+}
+
+// ValidScope reports whether scope is one Chirpy knows.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeChirpsWrite, ScopeChirpsDelete, ScopeUsersRead, ScopeUsersWrite, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// Claims are the claims of a Chirpy access token. Scope is space separated
+// like OAuth scopes; sid names the login session, the refresh token family,
+// the token was issued for.
+type Claims struct {
+	jwt.RegisteredClaims
+	SID   string `json:"sid,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	// ClientID names the OAuth client a token was issued to; it is empty
+	// for Chirpy's own tokens.
+	ClientID string `json:"client_id,omitempty"`
+
+	// Filled in by ValidateJWT.
+	UserID    uuid.UUID `json:"-"`
+	SessionID uuid.UUID `json:"-"`
+	// APIKeyID is set instead of a token when a request authenticated with
+	// a personal API key.
+	APIKeyID uuid.UUID `json:"-"`
+}
+
+// NewClaims returns the claims for a token of userID that expires after
+// expiresIn. sessionID may be uuid.Nil for tokens outside a login session.
+func NewClaims(userID, sessionID uuid.UUID, scopes []string, expiresIn time.Duration) Claims {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{TokenAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Scope: strings.Join(scopes, " "),
+	}
+	if sessionID != uuid.Nil {
+		claims.SID = sessionID.String()
+	}
+	return claims
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// resolve fills in the parsed IDs after the signature was verified.
+func (c *Claims) resolve() error {
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return err
+	}
+	c.UserID = userID
+	if c.SID != "" {
+		sessionID, err := uuid.Parse(c.SID)
+		if err != nil {
+			return err
+		}
+		c.SessionID = sessionID
+	}
+	return nil
+}
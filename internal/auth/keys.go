@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Issuer and audience of every access token Chirpy creates.
+const (
+	TokenIssuer   = "chirpy"
+	TokenAudience = "chirpy-api"
+)
+
+// Key is one JWT key. Asymmetric keys without a private part can only
+// verify; they are kept around after a rotation until the tokens they
+// signed expired.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// sign is the private key or HMAC secret, nil for verification only keys.
+	sign   any
+	verify any
+}
+
+// KeySet signs tokens with one key and verifies with any key it contains.
+// Accepted algorithms are pinned to those of the contained keys.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewHMACKeySet returns a key set with a single HS256 secret, the setup
+// Chirpy used before asymmetric keys. Its tokens carry no kid.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &Key{Method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}
+	return &KeySet{signing: key, keys: map[string]*Key{"": key}}
+}
+
+// NewKeySet signs with signing and verifies with signing and every key in
+// verify.
+func NewKeySet(signing *Key, verify ...*Key) (*KeySet, error) {
+	if signing == nil || signing.sign == nil {
+		return nil, errors.New("signing key has no private part")
+	}
+	ks := &KeySet{signing: signing, keys: map[string]*Key{}}
+	for _, key := range append([]*Key{signing}, verify...) {
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+// LoadKeySet reads the signing key and any number of verification keys from
+// PEM files.
+func LoadKeySet(signingFile string, verifyFiles ...string) (*KeySet, error) {
+	signing, err := loadKeyFile(signingFile)
+	if err != nil {
+		return nil, err
+	}
+	verify := []*Key{}
+	for _, file := range verifyFiles {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, key)
+	}
+	return NewKeySet(signing, verify...)
+}
+
+func loadKeyFile(file string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return key, nil
+}
+
+// ParseKeyPEM reads an Ed25519 or RSA key. Private keys may be PKCS#8 or,
+// for RSA, PKCS#1; public keys must be PKIX. The key ID is the key's RFC
+// 7638 thumbprint, so a public and private copy of a key share it.
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private, public any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := private.(crypto.Signer); ok {
+		public = signer.Public()
+	}
+
+	key := &Key{sign: private, verify: public}
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	key.ID = thumbprint(key.jwk())
+	return key, nil
+}
+
+// JWK is the public part of a key as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+func (k *Key) jwk() JWK {
+	switch pub := k.verify.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	}
+	return JWK{}
+}
+
+// thumbprint implements RFC 7638: the hash of the required members in
+// lexicographic order.
+func thumbprint(jwk JWK) string {
+	var canonical string
+	switch jwk.Kty {
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns the public keys of the set. HMAC secrets are never published.
+func (ks *KeySet) JWKS() []byte {
+	document := struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if _, ok := key.verify.([]byte); ok {
+			continue
+		}
+		jwk := key.jwk()
+		jwk.Kid = key.ID
+		jwk.Alg = key.Method.Alg()
+		jwk.Use = "sig"
+		document.Keys = append(document.Keys, jwk)
+	}
+	data, _ := json.Marshal(document)
+	return data
+}
+
+func (ks *KeySet) methods() []string {
+	methods := []string{}
+	for _, key := range ks.keys {
+		methods = append(methods, key.Method.Alg())
+	}
+	return methods
+}
+
+// SigningAlg returns the JWS algorithm new tokens are signed with.
+func (ks *KeySet) SigningAlg() string {
+	return ks.signing.Method.Alg()
+}
+
+// Sign signs claims with the signing key, setting kid for asymmetric keys.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.sign)
+}
+
+// Parse verifies tokenString into claims. The algorithm must be one of the
+// set's, the kid must name a key of that algorithm, and issuer, audience and
+// expiry are required.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.verify, nil
+	},
+		jwt.WithValidMethods(ks.methods()),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(TokenAudience),
+		jwt.WithExpirationRequired(),
+	)
+	return err
+}
+
+// MakeJWT creates an access token for userID without scopes.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.Sign(NewClaims(userID, uuid.Nil, nil, expiresIn))
+}
+
+// ValidateJWT verifies an access token and returns its claims.
+func (ks *KeySet) ValidateJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	err := ks.Parse(tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	err = claims.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func ed25519KeyPEM(t *testing.T) ([]byte, []byte) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	publicDER, _ := x509.MarshalPKIXPublicKey(public)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func mustParseKey(t *testing.T, data []byte) *Key {
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		t.Fatal("failed to parse key:", err)
+	}
+	return key
+}
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.New()
+	oldPrivate, oldPublic := ed25519KeyPEM(t)
+	newPrivate, _ := ed25519KeyPEM(t)
+
+	oldSet, err := NewKeySet(mustParseKey(t, oldPrivate))
+	if err != nil {
+		t.Fatal("failed to create key set:", err)
+	}
+	oldToken, err := oldSet.MakeJWT(userID, time.Hour)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	// After the rotation the old key only verifies.
+	rotated, err := NewKeySet(mustParseKey(t, newPrivate), mustParseKey(t, oldPublic))
+	if err != nil {
+		t.Fatal("failed to create key set:", err)
+	}
+	claims, err := rotated.ValidateJWT(oldToken)
+	if err != nil || claims.UserID != userID {
+		t.Errorf("Expected token of the old key to stay valid, got %+v (%v)", claims, err)
+	}
+	newToken, _ := rotated.MakeJWT(userID, time.Hour)
+	if _, err := oldSet.ValidateJWT(newToken); err == nil {
+		t.Errorf("Expected the old set to reject a token of the new key")
+	}
+
+	var jwks struct {
+		Keys []JWK `json:"keys"`
+	}
+	json.Unmarshal(rotated.JWKS(), &jwks)
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected 2 published keys, got %d", len(jwks.Keys))
+	}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "OKP" || jwk.Alg != "EdDSA" || jwk.Kid == "" {
+			t.Errorf("Unexpected JWK %+v", jwk)
+		}
+	}
+}
+
+func TestKeySetRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	ks, err := NewKeySet(mustParseKey(t, data))
+	if err != nil {
+		t.Fatal("failed to create key set:", err)
+	}
+	userID := uuid.New()
+	token, _ := ks.MakeJWT(userID, time.Hour)
+	claims, err := ks.ValidateJWT(token)
+	if err != nil || claims.UserID != userID {
+		t.Errorf("Expected ID %v, got %+v (%v)", userID, claims, err)
+	}
+	if !strings.Contains(string(ks.JWKS()), `"alg":"RS256"`) {
+		t.Errorf("Expected RS256 key in JWKS: %s", ks.JWKS())
+	}
+}
+
+func TestKeySetRejects(t *testing.T) {
+	userID := uuid.New()
+	private, public := ed25519KeyPEM(t)
+	key := mustParseKey(t, private)
+	ks, _ := NewKeySet(key)
+
+	t.Run("HS256 signed with the public key", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, NewClaims(userID, uuid.Nil, nil, time.Hour))
+		token.Header["kid"] = key.ID
+		signed, _ := token.SignedString(public)
+		if _, err := ks.ValidateJWT(signed); err == nil {
+			t.Errorf("Expected algorithm confusion to be rejected")
+		}
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		claims := NewClaims(userID, uuid.Nil, nil, time.Hour)
+		claims.Audience = jwt.ClaimStrings{"someone-else"}
+		signed, _ := ks.Sign(claims)
+		if _, err := ks.ValidateJWT(signed); err == nil {
+			t.Errorf("Expected foreign audience to be rejected")
+		}
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		claims := NewClaims(userID, uuid.Nil, nil, time.Hour)
+		claims.Issuer = "evil"
+		signed, _ := ks.Sign(claims)
+		if _, err := ks.ValidateJWT(signed); err == nil {
+			t.Errorf("Expected foreign issuer to be rejected")
+		}
+	})
+
+	t.Run("HMAC set publishes nothing", func(t *testing.T) {
+		if got := string(NewHMACKeySet("secret").JWKS()); got != `{"keys":[]}` {
+			t.Errorf("Unexpected JWKS for HMAC set: %v", got)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// bcryptMaxPassword is the number of bytes bcrypt actually uses. Anything
+// beyond would be silently ignored, so longer passwords are refused instead.
+const bcryptMaxPassword = 72
+
+var (
+	ErrIncorrectPassword   = errors.New("Incorrect password")
+	ErrPasswordTooLong     = fmt.Errorf("Password must not be longer than %d bytes", bcryptMaxPassword)
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+// Argon2idParams tune the cost of argon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHasher hashes new passwords with Algorithm and verifies hashes of
+// every supported algorithm. Hashes are stored in PHC string format, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>; bcrypt hashes keep their
+// own $2a$<cost>$ format.
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2id   Argon2idParams
+	BcryptCost int
+}
+
+// DefaultPasswordHasher uses argon2id with the parameters recommended by
+// OWASP.
+var DefaultPasswordHasher = &PasswordHasher{
+	Algorithm: Argon2id,
+	Argon2id: Argon2idParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: 12,
+}
+
+// Hash returns the encoded hash of password.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case Argon2id:
+		salt := make([]byte, h.Argon2id.SaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+		return encodeArgon2id(h.Argon2id, salt, password), nil
+	case Bcrypt:
+		if len(password) > bcryptMaxPassword {
+			return "", ErrPasswordTooLong
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", h.Algorithm)
+	}
+}
+
+// Verify checks password against hash. needsRehash reports whether hash was
+// made with another algorithm or other parameters than h would use now, so
+// it should be replaced by a fresh hash while the password is at hand.
+func (h *PasswordHasher) Verify(password, hash string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		params.SaltLength = uint32(len(salt))
+		params.KeyLength = uint32(len(key))
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, ErrIncorrectPassword
+		}
+		return h.Algorithm != Argon2id || params != h.Argon2id, nil
+	case strings.HasPrefix(hash, "$2"):
+		// bcrypt would compare only the first 72 bytes, accepting any
+		// suffix. No hash of a longer password is ever created.
+		if len(password) > bcryptMaxPassword {
+			return false, ErrIncorrectPassword
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err != nil {
+			return false, ErrIncorrectPassword
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, err
+		}
+		return h.Algorithm != Bcrypt || cost != h.BcryptCost, nil
+	default:
+		return false, ErrUnknownPasswordHash
+	}
+}
+
+func encodeArgon2id(params Argon2idParams, salt []byte, password string) string {
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters %q", parts[3])
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	if len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := *DefaultPasswordHasher
+	hasher.Argon2id.Memory = 1024
+
+	hash, err := hasher.Hash("los pollos hermanos")
+	if err != nil {
+		t.Fatal("failed to hash password:", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=2,p=1$") {
+		t.Errorf("Unexpected hash format %v", hash)
+	}
+	other, _ := hasher.Hash("los pollos hermanos")
+	if other == hash {
+		t.Errorf("Expected hashes of the same password to be salted differently")
+	}
+
+	needsRehash, err := hasher.Verify("los pollos hermanos", hash)
+	if err != nil || needsRehash {
+		t.Errorf("Expected current hash to verify without rehash, got %v (%v)", needsRehash, err)
+	}
+	if _, err := hasher.Verify("los pollos hermano", hash); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Expected wrong password to be rejected, got %v", err)
+	}
+
+	stronger := hasher
+	stronger.Argon2id.Iterations = 3
+	needsRehash, err = stronger.Verify("los pollos hermanos", hash)
+	if err != nil || !needsRehash {
+		t.Errorf("Expected hash with old parameters to need a rehash, got %v (%v)", needsRehash, err)
+	}
+
+	if _, err := hasher.Verify("", ""); !errors.Is(err, ErrUnknownPasswordHash) {
+		t.Errorf("Expected empty hash to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordHasherBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("say my name"), 4)
+	if err != nil {
+		t.Fatal("failed to hash password:", err)
+	}
+	hasher := *DefaultPasswordHasher
+	needsRehash, err := hasher.Verify("say my name", string(legacy))
+	if err != nil || !needsRehash {
+		t.Errorf("Expected bcrypt hash to verify and need a rehash, got %v (%v)", needsRehash, err)
+	}
+
+	hasher.Algorithm = Bcrypt
+	hasher.BcryptCost = 4
+	needsRehash, err = hasher.Verify("say my name", string(legacy))
+	if err != nil || needsRehash {
+		t.Errorf("Expected bcrypt hash with current cost to be kept, got %v (%v)", needsRehash, err)
+	}
+
+	long := strings.Repeat("a", 72)
+	hash, err := hasher.Hash(long)
+	if err != nil {
+		t.Fatal("failed to hash 72 byte password:", err)
+	}
+	if _, err := hasher.Hash(long + "b"); !errors.Is(err, ErrPasswordTooLong) {
+		t.Errorf("Expected 73 byte password to be refused, got %v", err)
+	}
+	if _, err := hasher.Verify(long+"b", hash); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("Expected bytes beyond 72 not to be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 secret, truncated to six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal("failed to compute code:", err)
+		}
+		if got != c.want {
+			t.Errorf("Unexpected code at %d: got %v, want %v", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal("failed to generate secret:", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	t.Run("previous period is accepted", func(t *testing.T) {
+		code, _ := TOTPCode(secret, TOTPStep(now)-1)
+		step, err := ValidateTOTP(secret, code, now)
+		if err != nil {
+			t.Fatal("Expected code to be valid:", err)
+		}
+		if step != TOTPStep(now)-1 {
+			t.Errorf("Expected matched step %d, got %d", TOTPStep(now)-1, step)
+		}
+	})
+
+	t.Run("old code is rejected", func(t *testing.T) {
+		code, _ := TOTPCode(secret, TOTPStep(now)-3)
+		_, err := ValidateTOTP(secret, code, now)
+		if err == nil {
+			t.Errorf("Expected code from three periods ago to be rejected")
+		}
+	})
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "walt@breakingbad.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@breakingbad.com?") {
+		t.Errorf("Unexpected URI: %v", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("Secret missing from URI: %v", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal("failed to generate codes:", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected code format: %v", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %v", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(strings.ToUpper(strings.Replace(code, "-", "", 1))) != code {
+			t.Errorf("Normalizing did not restore %v", code)
+		}
+	}
+}
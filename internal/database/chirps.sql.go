@@ -12,24 +12,26 @@ import (
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.ReplyToID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +39,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
 	)
 	return i, err
 }
@@ -60,11 +63,16 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps
+WHERE can_view_chirps_of(user_id, $1)
+	AND NOT EXISTS (
+		SELECT 1 FROM mutes WHERE mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+	)
+ORDER BY created_at ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +86,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -93,11 +102,18 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getAllChirpsForAuthor = `-- name: GetAllChirpsForAuthor :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps
+WHERE user_id = $1 AND can_view_chirps_of(user_id, $2)
+ORDER BY created_at ASC
 `
 
-func (q *Queries) GetAllChirpsForAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirpsForAuthor, userID)
+type GetAllChirpsForAuthorParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetAllChirpsForAuthor(ctx context.Context, arg GetAllChirpsForAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsForAuthor, arg.UserID, arg.ViewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +127,7 @@ func (q *Queries) GetAllChirpsForAuthor(ctx context.Context, userID uuid.UUID) (
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
 		); err != nil {
 			return nil, err
 		}
@@ -126,7 +143,7 @@ func (q *Queries) GetAllChirpsForAuthor(ctx context.Context, userID uuid.UUID) (
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -138,6 +155,30 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+	)
+	return i, err
+}
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT id, created_at, updated_at, body, user_id, reply_to_id FROM chirps WHERE id = $1 AND can_view_chirps_of(user_id, $2)
+`
+
+type GetVisibleChirpParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetVisibleChirp(ctx context.Context, arg GetVisibleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirp, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
 	)
 	return i, err
 }
@@ -6,33 +6,286 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	UserID     uuid.UUID
+}
+
+type AuditLog struct {
+	ID         int64
+	CreatedAt  time.Time
+	Action     string
+	ActorID    uuid.NullUUID
+	TargetType string
+	TargetID   string
+	IpAddress  string
+	UserAgent  string
+	RequestID  string
+	Diff       json.RawMessage
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	ReplyToID uuid.NullUUID
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
 	CreatedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+	Status     string
+}
+
+type LoginFailure struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
+	ID        int64
+	Type      string
+	GroupKey  string
+	ActorIds  []uuid.UUID
+	SubjectID uuid.NullUUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ReadAt    sql.NullTime
+	UserID    uuid.UUID
+	Seq       int64
+}
+
+type NotificationPreference struct {
+	Type      string
+	Enabled   bool
 	UpdatedAt time.Time
+	UserID    uuid.UUID
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	GrantID       uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+	ClientID      string
+	UserID        uuid.UUID
+}
+
+type OauthClient struct {
+	ID           string
+	SecretHash   sql.NullString
+	Name         string
+	RedirectUris []string
+	Scopes       []string
+	CreatedAt    time.Time
+	UserID       uuid.UUID
+}
+
+type OauthRefreshToken struct {
+	TokenHash string
+	GrantID   uuid.UUID
+	Scopes    []string
+	AuthTime  time.Time
+	CreatedAt time.Time
 	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 	RevokedAt sql.NullTime
+	ClientID  string
 	UserID    uuid.UUID
 }
 
+type Outbox struct {
+	ID            uuid.UUID
+	EventType     string
+	AggregateID   uuid.UUID
+	Payload       json.RawMessage
+	OccurredAt    time.Time
+	DispatchedAt  sql.NullTime
+	Attempts      int32
+	LastError     sql.NullString
+	HandledBy     []string
+	NextAttemptAt time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type Rechirp struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type RefreshToken struct {
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   time.Time
+	RevokedAt   sql.NullTime
+	UserID      uuid.UUID
+	FamilyID    uuid.UUID
+	RotatedAt   sql.NullTime
+	ID          uuid.UUID
+	TokenHash   string
+	TokenPrefix string
+	UserAgent   string
+	IpAddress   string
+	LastUsedAt  time.Time
+}
+
+type RoleChange struct {
+	ID        uuid.UUID
+	OldRole   string
+	NewRole   string
+	Reason    string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ChangedBy uuid.NullUUID
+}
+
+type SecurityEvent struct {
+	ID        uuid.UUID
+	EventType string
+	Details   json.RawMessage
+	CreatedAt time.Time
+	UserID    uuid.NullUUID
+}
+
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   sql.NullString
+	IsChirpyRed      bool
+	EmailVerifiedAt  sql.NullTime
+	TotpSecret       sql.NullString
+	TotpEnabledAt    sql.NullTime
+	TotpLastStep     int64
+	Role             string
+	SuspendedAt      sql.NullTime
+	SuspendedUntil   sql.NullTime
+	SuspensionReason string
+	ShadowBannedAt   sql.NullTime
+	IsPrivate        bool
+	Handle           sql.NullString
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt sql.NullTime
+	UserID      uuid.UUID
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EventID       uuid.UUID
+	EventType     string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int32
+	NextAttemptAt time.Time
+	DeliveredAt   sql.NullTime
+	EndpointID    uuid.UUID
+}
+
+type WebhookDeliveryAttempt struct {
+	ID          uuid.UUID
+	Attempt     int32
+	AttemptedAt time.Time
+	StatusCode  sql.NullInt32
+	Error       sql.NullString
+	DurationMs  int32
+	DeliveryID  uuid.UUID
+}
+
+type WebhookEndpoint struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Url          string
+	Secret       string
+	EventTypes   []string
+	FailureCount int32
+	DisabledAt   sql.NullTime
+	UserID       uuid.UUID
+	ClientID     sql.NullString
+}
+
+type WebhookEvent struct {
+	ID          string
+	EventType   string
+	Payload     json.RawMessage
+	ReceivedAt  time.Time
+	Status      string
+	Error       sql.NullString
+	ProcessedAt sql.NullTime
+	LockedUntil time.Time
 }
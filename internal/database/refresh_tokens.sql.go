@@ -13,34 +13,51 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
+INSERT INTO refresh_tokens (id, token_hash, token_prefix, created_at, updated_at, expires_at, revoked_at, user_id, family_id, user_agent, ip_address, last_used_at)
 VALUES (
+	gen_random_uuid(),
 	$1,
+	$2,
 	NOW(),
 	NOW(),
-	$2,
+	$3,
     NULL,
-    $3
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW()
 )
-RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id
+RETURNING created_at, updated_at, expires_at, revoked_at, user_id, family_id, rotated_at, id, token_hash, token_prefix, user_agent, ip_address, last_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	ExpiresAt time.Time
-	UserID    uuid.UUID
+	TokenHash   string
+	TokenPrefix string
+	ExpiresAt   time.Time
+	UserID      uuid.UUID
+	FamilyID    uuid.UUID
+	UserAgent   string
+	IpAddress   string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.ExpiresAt, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.TokenHash, arg.TokenPrefix, arg.ExpiresAt, arg.UserID, arg.FamilyID, arg.UserAgent, arg.IpAddress)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.ID,
+		&i.TokenHash,
+		&i.TokenPrefix,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
@@ -54,16 +71,160 @@ func (q *Queries) DeleteAllRefreshTokens(ctx context.Context) error {
 	return err
 }
 
-const revokeTokenAccess = `-- name: RevokeTokenAccess :exec
-UPDATE refresh_tokens SET expires_at = $2 WHERE token = $1
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT created_at, updated_at, expires_at, revoked_at, user_id, family_id, rotated_at, id, token_hash, token_prefix, user_agent, ip_address, last_used_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE
+`
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.ID,
+		&i.TokenHash,
+		&i.TokenPrefix,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const listSessions = `-- name: ListSessions :many
+SELECT
+	r.family_id,
+	r.user_agent,
+	r.ip_address,
+	r.last_used_at,
+	r.expires_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = r.family_id)::timestamp AS created_at
+FROM refresh_tokens r
+WHERE r.user_id = $1 AND r.rotated_at IS NULL AND r.revoked_at IS NULL AND r.expires_at > NOW()
+ORDER BY r.last_used_at DESC
 `
 
-type RevokeTokenAccessParams struct {
-	Token     string
-	ExpiresAt time.Time
+type ListSessionsRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
+
+func (q *Queries) ListSessions(ctx context.Context, userID uuid.UUID) ([]ListSessionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSessionsRow
+	for rows.Next() {
+		var i ListSessionsRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) RevokeTokenAccess(ctx context.Context, arg RevokeTokenAccessParams) error {
-	_, err := q.db.ExecContext(ctx, revokeTokenAccess, arg.Token, arg.ExpiresAt)
+const markRefreshTokenRotated = `-- name: MarkRefreshTokenRotated :exec
+UPDATE refresh_tokens SET rotated_at = NOW(), updated_at = NOW() WHERE id = $1
+`
+
+func (q *Queries) MarkRefreshTokenRotated(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markRefreshTokenRotated, id)
 	return err
 }
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeTokenAccess = `-- name: RevokeTokenAccess :one
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING user_id, family_id
+`
+
+type RevokeTokenAccessRow struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeTokenAccess(ctx context.Context, tokenHash string) (RevokeTokenAccessRow, error) {
+	row := q.db.QueryRowContext(ctx, revokeTokenAccess, tokenHash)
+	var i RevokeTokenAccessRow
+	err := row.Scan(
+		&i.UserID,
+		&i.FamilyID,
+	)
+	return i, err
+}
@@ -7,10 +7,55 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const createPasswordlessUser = `-- name: CreatePasswordlessUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, email_verified_at)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	NULL,
+	$2
+)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle
+`
+
+type CreatePasswordlessUserParams struct {
+	Email           string
+	EmailVerifiedAt sql.NullTime
+}
+
+func (q *Queries) CreatePasswordlessUser(ctx context.Context, arg CreatePasswordlessUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createPasswordlessUser, arg.Email, arg.EmailVerifiedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -20,12 +65,12 @@ VALUES (
 	$1,
 	$2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle
 `
 
 type CreateUserParams struct {
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -38,6 +83,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
 	)
 	return i, err
 }
@@ -51,8 +107,49 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const enableUserTOTP = `-- name: EnableUserTOTP :execrows
+UPDATE users SET totp_enabled_at = NOW(), updated_at = NOW() WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+`
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableUserTOTP, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
+	)
+	return i, err
+}
+
 const getUserByMail = `-- name: GetUserByMail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByMail(ctx context.Context, email string) (User, error) {
@@ -65,21 +162,142 @@ func (q *Queries) GetUserByMail(ctx context.Context, email string) (User, error)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT u.id FROM users u INNER JOIN refresh_tokens r ON u.id = r.user_id WHERE r.token = $1 AND r.expires_at > NOW() AND r.revoked_at IS NULL
+SELECT u.id FROM users u INNER JOIN refresh_tokens r ON u.id = r.user_id WHERE r.token_hash = $1 AND r.expires_at > NOW() AND r.revoked_at IS NULL
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle FROM users WHERE handle = ANY($1::TEXT[])
+`
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.EmailVerifiedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.Role,
+			&i.SuspendedAt,
+			&i.SuspendedUntil,
+			&i.SuspensionReason,
+			&i.ShadowBannedAt,
+			&i.IsPrivate,
+			&i.Handle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserHandle = `-- name: SetUserHandle :one
+UPDATE users SET handle = $2, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle
+`
+
+type SetUserHandleParams struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) SetUserHandle(ctx context.Context, arg SetUserHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserHandle, arg.ID, arg.Handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const setUserPrivate = `-- name: SetUserPrivate :exec
+UPDATE users SET is_private = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetUserPrivateParams struct {
+	ID        uuid.UUID
+	IsPrivate bool
+}
+
+func (q *Queries) SetUserPrivate(ctx context.Context, arg SetUserPrivateParams) error {
+	_, err := q.db.ExecContext(ctx, setUserPrivate, arg.ID, arg.IsPrivate)
+	return err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :execrows
+UPDATE users SET totp_secret = $2, updated_at = NOW() WHERE id = $1 AND totp_enabled_at IS NULL
+`
+
+type SetUserTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.ID, arg.TotpSecret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const subscribeUser = `-- name: SubscribeUser :exec
 UPDATE users SET is_chirpy_red = true WHERE id = $1
 `
@@ -90,13 +308,18 @@ func (q *Queries) SubscribeUser(ctx context.Context, id uuid.UUID) error {
 }
 
 const updateUserPassAndMailByID = `-- name: UpdateUserPassAndMailByID :one
-UPDATE users SET email=$2, hashed_password = $3, updated_at = NOW() WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET
+	email = $2,
+	hashed_password = $3,
+	email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+	updated_at = NOW()
+WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, suspended_at, suspended_until, suspension_reason, shadow_banned_at, is_private, handle
 `
 
 type UpdateUserPassAndMailByIDParams struct {
 	ID             uuid.UUID
 	Email          string
-	HashedPassword string
+	HashedPassword sql.NullString
 }
 
 func (q *Queries) UpdateUserPassAndMailByID(ctx context.Context, arg UpdateUserPassAndMailByIDParams) (User, error) {
@@ -109,6 +332,67 @@ func (q *Queries) UpdateUserPassAndMailByID(ctx context.Context, arg UpdateUserP
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspendedUntil,
+		&i.SuspensionReason,
+		&i.ShadowBannedAt,
+		&i.IsPrivate,
+		&i.Handle,
 	)
 	return i, err
 }
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword sql.NullString
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const upgradeUserPasswordHash = `-- name: UpgradeUserPasswordHash :execrows
+UPDATE users SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpgradeUserPasswordHashParams struct {
+	NewHash sql.NullString
+	ID      uuid.UUID
+	OldHash sql.NullString
+}
+
+func (q *Queries) UpgradeUserPasswordHash(ctx context.Context, arg UpgradeUserPasswordHashParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUserPasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2
+`
+
+type UseTOTPStepParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Domain event types. Most of them double as the public webhook event names.
+const (
+	ChirpCreated = "chirp.created"
+	ChirpDeleted = "chirp.deleted"
+	UserCreated  = "user.created"
+	UserUpgraded = "user.upgraded"
+	UserFollowed = "user.followed"
+	// FollowRequested and FollowApproved are the two steps of following a
+	// private user.
+	FollowRequested = "user.follow_requested"
+	FollowApproved  = "user.follow_approved"
+	// ChirpLiked and ChirpRechirped only feed notifications, integrators
+	// cannot subscribe to them.
+	ChirpLiked     = "chirp.liked"
+	ChirpRechirped = "chirp.rechirped"
+)
+
+// Event records a state change that already happened. It is written to the
+// outbox in the same transaction as the change itself.
+type Event struct {
+	ID          uuid.UUID
+	Type        string
+	AggregateID uuid.UUID
+	Payload     json.RawMessage
+	OccurredAt  time.Time
+}
+
+func New(eventType string, aggregateID uuid.UUID, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:          uuid.New(),
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     payload,
+		OccurredAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Sink consumes dispatched events. A sink that failed gets the event again,
+// the sinks that succeeded do not. Sinks should still be idempotent, since
+// the relay can stop between handling an event and recording it.
+type Sink interface {
+	Handle(ctx context.Context, event Event) error
+}
+
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Handle(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Pending is an outbox event that has not been dispatched yet.
+type Pending struct {
+	Event Event
+	// Attempts counts the earlier failed dispatches.
+	Attempts int
+	// Handled names the sinks that already handled the event.
+	Handled []string
+}
+
+// Store hands pending outbox events to the relay. ClaimDue returns up to
+// limit events that are due at now and have failed fewer than maxAttempts
+// times, oldest first, and hides them from other relays until lockedUntil.
+// No transaction is held while the sinks run; the claim is a lease.
+type Store interface {
+	ClaimDue(ctx context.Context, now time.Time, limit, maxAttempts int, lockedUntil time.Time) ([]Pending, error)
+	MarkDispatched(ctx context.Context, id uuid.UUID) error
+	// MarkFailed records a failed attempt, the sinks that handled the event
+	// so far and when to try again.
+	MarkFailed(ctx context.Context, id uuid.UUID, handled []string, err error, nextAttemptAt time.Time) error
+}
+
+type Relay struct {
+	Store Store
+	// Sinks by name. The name is recorded once a sink handled an event, so
+	// it has to stay the same across deployments.
+	Sinks     map[string]Sink
+	Interval  time.Duration
+	BatchSize int
+	// MaxAttempts is the number of tries before an event is left in the
+	// outbox for manual inspection.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed batch is hidden from other relays. It has
+	// to outlast handling the whole batch.
+	Lease time.Duration
+	Now   func() time.Time
+	wake  chan struct{}
+}
+
+func NewRelay(store Store, sinks map[string]Sink) *Relay {
+	return &Relay{
+		Store:       store,
+		Sinks:       sinks,
+		Interval:    2 * time.Second,
+		BatchSize:   100,
+		MaxAttempts: 10,
+		BaseBackoff: 5 * time.Second,
+		MaxBackoff:  time.Hour,
+		Lease:       5 * time.Minute,
+		Now:         time.Now,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Wake asks the relay to poll right away instead of waiting for the next
+// tick. Handlers call it after committing a transaction that wrote events.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches pending events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.DispatchPending(ctx)
+			if err != nil {
+				log.Printf("outbox: dispatching events: %v", err)
+			}
+			if err != nil || n < r.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Backoff returns the delay before the attempt following attempt number n.
+func (r *Relay) Backoff(n int) time.Duration {
+	delay := r.BaseBackoff
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= r.MaxBackoff {
+			return r.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// DispatchPending hands one batch of due events to every sink that did not
+// handle them yet and returns the number of events claimed. A failed event
+// is retried after Backoff.
+func (r *Relay) DispatchPending(ctx context.Context) (int, error) {
+	names := make([]string, 0, len(r.Sinks))
+	for name := range r.Sinks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	now := r.Now()
+	batch, err := r.Store.ClaimDue(ctx, now, r.BatchSize, r.MaxAttempts, now.Add(r.Lease))
+	if err != nil {
+		return 0, err
+	}
+	for _, pending := range batch {
+		handled := pending.Handled
+		var errs []error
+		for _, name := range names {
+			if slices.Contains(handled, name) {
+				continue
+			}
+			err := r.Sinks[name].Handle(ctx, pending.Event)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			handled = append(handled, name)
+		}
+		if len(errs) > 0 {
+			attempt := pending.Attempts + 1
+			err = r.Store.MarkFailed(ctx, pending.Event.ID, handled, errors.Join(errs...), r.Now().Add(r.Backoff(attempt)))
+		} else {
+			err = r.Store.MarkDispatched(ctx, pending.Event.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
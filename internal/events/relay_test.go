@@ -0,0 +1,192 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memStore struct {
+	mu          sync.Mutex
+	events      []Event
+	dispatched  map[uuid.UUID]int
+	failures    map[uuid.UUID]int
+	handled     map[uuid.UUID][]string
+	nextAttempt map[uuid.UUID]time.Time
+}
+
+func newMemStore(events ...Event) *memStore {
+	return &memStore{
+		events:      events,
+		dispatched:  map[uuid.UUID]int{},
+		failures:    map[uuid.UUID]int{},
+		handled:     map[uuid.UUID][]string{},
+		nextAttempt: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (s *memStore) ClaimDue(ctx context.Context, now time.Time, limit, maxAttempts int, lockedUntil time.Time) ([]Pending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batch []Pending
+	for _, event := range s.events {
+		if len(batch) == limit {
+			break
+		}
+		if s.dispatched[event.ID] > 0 || s.failures[event.ID] >= maxAttempts || s.nextAttempt[event.ID].After(now) {
+			continue
+		}
+		s.nextAttempt[event.ID] = lockedUntil
+		batch = append(batch, Pending{Event: event, Attempts: s.failures[event.ID], Handled: s.handled[event.ID]})
+	}
+	return batch, nil
+}
+
+func (s *memStore) MarkDispatched(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dispatched[id]++
+	return nil
+}
+
+func (s *memStore) MarkFailed(ctx context.Context, id uuid.UUID, handled []string, err error, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[id]++
+	s.handled[id] = handled
+	s.nextAttempt[id] = nextAttemptAt
+	return nil
+}
+
+func mustEvent(t *testing.T, eventType string) Event {
+	event, err := New(eventType, uuid.New(), map[string]string{"body": "hello"})
+	if err != nil {
+		t.Fatal("failed to create event:", err)
+	}
+	return event
+}
+
+func TestRelayDispatchesToAllSinks(t *testing.T) {
+	first := mustEvent(t, ChirpCreated)
+	second := mustEvent(t, ChirpDeleted)
+	store := newMemStore(first, second)
+
+	var got []string
+	recorder := SinkFunc(func(ctx context.Context, event Event) error {
+		got = append(got, event.Type)
+		return nil
+	})
+	counted := 0
+	counter := SinkFunc(func(ctx context.Context, event Event) error {
+		counted++
+		return nil
+	})
+
+	relay := NewRelay(store, map[string]Sink{"recorder": recorder, "counter": counter})
+	n, err := relay.DispatchPending(context.Background())
+	if err != nil {
+		t.Fatal("failed to dispatch:", err)
+	}
+	if n != 2 || counted != 2 {
+		t.Errorf("Expected 2 events dispatched to both sinks, got %d claimed and %d counted", n, counted)
+	}
+	if len(got) != 2 || got[0] != ChirpCreated || got[1] != ChirpDeleted {
+		t.Errorf("Unexpected dispatch order: %v", got)
+	}
+
+	// Dispatched events are never handed out again.
+	n, _ = relay.DispatchPending(context.Background())
+	if n != 0 || store.dispatched[first.ID] != 1 || store.dispatched[second.ID] != 1 {
+		t.Errorf("Expected every event to be dispatched exactly once, got %v", store.dispatched)
+	}
+}
+
+func TestRelayRetriesFailedEvents(t *testing.T) {
+	event := mustEvent(t, UserCreated)
+	store := newMemStore(event)
+
+	fail := true
+	flaky := SinkFunc(func(ctx context.Context, event Event) error {
+		if fail {
+			return fmt.Errorf("sink unavailable")
+		}
+		return nil
+	})
+
+	steady := 0
+	counter := SinkFunc(func(ctx context.Context, event Event) error {
+		steady++
+		return nil
+	})
+
+	now := time.Now()
+	relay := NewRelay(store, map[string]Sink{"flaky": flaky, "steady": counter})
+	relay.Now = func() time.Time { return now }
+	relay.DispatchPending(context.Background())
+	if store.dispatched[event.ID] != 0 || store.failures[event.ID] != 1 {
+		t.Fatalf("Expected failed event to stay pending, got %d dispatched and %d failures", store.dispatched[event.ID], store.failures[event.ID])
+	}
+
+	fail = false
+	now = now.Add(relay.Backoff(1))
+	relay.DispatchPending(context.Background())
+	if store.dispatched[event.ID] != 1 {
+		t.Errorf("Expected event to be dispatched on retry")
+	}
+	if steady != 1 {
+		t.Errorf("Expected the sink that succeeded to handle the event once, got %d", steady)
+	}
+}
+
+func TestRelayBacksOffFailedEvents(t *testing.T) {
+	event := mustEvent(t, ChirpCreated)
+	store := newMemStore(event)
+	attempts := 0
+	down := SinkFunc(func(ctx context.Context, event Event) error {
+		attempts++
+		return fmt.Errorf("sink unavailable")
+	})
+
+	now := time.Now()
+	relay := NewRelay(store, map[string]Sink{"down": down})
+	relay.Now = func() time.Time { return now }
+	relay.MaxAttempts = 3
+
+	relay.DispatchPending(context.Background())
+	n, _ := relay.DispatchPending(context.Background())
+	if n != 0 || attempts != 1 {
+		t.Fatalf("Expected the failed event to wait for its backoff, got %d claimed after %d attempts", n, attempts)
+	}
+	now = now.Add(relay.Backoff(1) - time.Millisecond)
+	relay.DispatchPending(context.Background())
+	if attempts != 1 {
+		t.Fatalf("Expected no attempt before the backoff ran out, got %d attempts", attempts)
+	}
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(relay.MaxBackoff)
+		relay.DispatchPending(context.Background())
+	}
+	if attempts != relay.MaxAttempts {
+		t.Errorf("Expected %d attempts before giving up, got %d", relay.MaxAttempts, attempts)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(newMemStore(), nil)
+	cases := map[int]time.Duration{
+		1:  5 * time.Second,
+		2:  10 * time.Second,
+		3:  20 * time.Second,
+		20: time.Hour,
+	}
+	for n, want := range cases {
+		if got := relay.Backoff(n); got != want {
+			t.Errorf("Backoff(%d) = %v, expected %v", n, got, want)
+		}
+	}
+}
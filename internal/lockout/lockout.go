@@ -0,0 +1,164 @@
+// Package lockout slows down and eventually blocks repeated failed login
+// attempts. Failures are counted per key, e.g. per account and per client
+// IP, in a Store shared by all server instances.
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Counter is the failure state of one key.
+type Counter struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists counters. The server uses Postgres so every instance sees
+// the same counts; MemoryStore suits a single instance and tests.
+type Store interface {
+	Get(ctx context.Context, key string) (Counter, error)
+	// RecordFailure atomically adds a failure at now and returns the new
+	// counter. Failures before now-window no longer count.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how failures are punished.
+type Policy struct {
+	// FreeAttempts failures are allowed without any delay.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure beyond FreeAttempts;
+	// it doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockAfter failures within Window lock the key for LockDuration.
+	LockAfter    int
+	LockDuration time.Duration
+	Window       time.Duration
+}
+
+// Delay is the wait required after failures consecutive failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Guard applies a Policy to the keys of one kind.
+type Guard struct {
+	Store  Store
+	Policy Policy
+	// Prefix keeps the keys of different guards sharing a store apart.
+	Prefix string
+	Now    func() time.Time
+}
+
+func NewGuard(store Store, prefix string, policy Policy) *Guard {
+	return &Guard{Store: store, Policy: policy, Prefix: prefix, Now: time.Now}
+}
+
+// Wait returns how long key has to wait before the next attempt, zero if
+// it may try now.
+func (g *Guard) Wait(ctx context.Context, key string) (time.Duration, error) {
+	counter, err := g.Store.Get(ctx, g.Prefix+key)
+	if err != nil {
+		return 0, err
+	}
+	now := g.Now()
+	if now.Sub(counter.LastFailure) >= g.Policy.Window {
+		counter.Failures = 0
+	}
+	wait := max(counter.LockedUntil.Sub(now), counter.LastFailure.Add(g.Policy.Delay(counter.Failures)).Sub(now))
+	return max(wait, 0), nil
+}
+
+// Fail records a failed attempt of key. locked reports whether this failure
+// locked the key.
+func (g *Guard) Fail(ctx context.Context, key string) (locked bool, err error) {
+	now := g.Now()
+	counter, err := g.Store.RecordFailure(ctx, g.Prefix+key, now, g.Policy.Window)
+	if err != nil {
+		return false, err
+	}
+	if counter.Failures < g.Policy.LockAfter || now.Before(counter.LockedUntil) {
+		return false, nil
+	}
+	err = g.Store.Lock(ctx, g.Prefix+key, now.Add(g.Policy.LockDuration))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Succeed forgets the failures of key.
+func (g *Guard) Succeed(ctx context.Context, key string) error {
+	return g.Store.Reset(ctx, g.Prefix+key)
+}
+
+// MemoryStore keeps counters in the process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: map[string]Counter{}}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.counters[key]
+	if now.Sub(counter.LastFailure) >= window {
+		counter.Failures = 0
+	}
+	counter.Failures++
+	counter.LastFailure = now
+	s.counters[key] = counter
+	s.prune(now, window)
+	return counter, nil
+}
+
+// prune drops stale counters once the map grows, so spraying many keys does
+// not grow it without bound.
+func (s *MemoryStore) prune(now time.Time, window time.Duration) {
+	if len(s.counters) < 10000 {
+		return
+	}
+	for key, counter := range s.counters {
+		if now.Sub(counter.LastFailure) >= window && now.After(counter.LockedUntil) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.counters[key]
+	counter.LockedUntil = until
+	s.counters[key] = counter
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
@@ -0,0 +1,109 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     8 * time.Second,
+	LockAfter:    6,
+	LockDuration: 15 * time.Minute,
+	Window:       time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		0:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		6:  4 * time.Second,
+		7:  8 * time.Second,
+		20: 8 * time.Second,
+	}
+	for failures, want := range cases {
+		if got := testPolicy.Delay(failures); got != want {
+			t.Errorf("Unexpected delay after %d failures: got %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := NewGuard(NewMemoryStore(), "account:", testPolicy)
+	g.Now = func() time.Time { return now }
+
+	fail := func() bool {
+		locked, err := g.Fail(ctx, "walt")
+		if err != nil {
+			t.Fatal("failed to record failure:", err)
+		}
+		return locked
+	}
+	wait := func() time.Duration {
+		wait, err := g.Wait(ctx, "walt")
+		if err != nil {
+			t.Fatal("failed to read counter:", err)
+		}
+		return wait
+	}
+
+	for range 3 {
+		fail()
+	}
+	if w := wait(); w != 0 {
+		t.Errorf("Expected no delay within the free attempts, got %v", w)
+	}
+	fail()
+	if w := wait(); w != time.Second {
+		t.Errorf("Expected 1s delay, got %v", w)
+	}
+	now = now.Add(time.Second)
+	if w := wait(); w != 0 {
+		t.Errorf("Expected delay to be over, got %v", w)
+	}
+
+	fail()
+	if locked := fail(); !locked {
+		t.Fatalf("Expected the sixth failure to lock")
+	}
+	if w := wait(); w != testPolicy.LockDuration {
+		t.Errorf("Expected lockout of %v, got %v", testPolicy.LockDuration, w)
+	}
+	if w, _ := g.Wait(ctx, "jesse"); w != 0 {
+		t.Errorf("Expected other keys to be unaffected, got %v", w)
+	}
+
+	now = now.Add(testPolicy.LockDuration)
+	if w := wait(); w != 0 {
+		t.Errorf("Expected lockout to expire, got %v", w)
+	}
+	g.Succeed(ctx, "walt")
+	fail()
+	if w := wait(); w != 0 {
+		t.Errorf("Expected success to reset the counter, got %v", w)
+	}
+}
+
+func TestGuardWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	g := NewGuard(NewMemoryStore(), "ip:", testPolicy)
+	g.Now = func() time.Time { return now }
+
+	for range 5 {
+		g.Fail(ctx, "10.0.0.1")
+	}
+	now = now.Add(testPolicy.Window)
+	if locked, _ := g.Fail(ctx, "10.0.0.1"); locked {
+		t.Errorf("Expected failures outside the window not to count")
+	}
+	if w, _ := g.Wait(ctx, "10.0.0.1"); w != 0 {
+		t.Errorf("Expected no delay after the first failure in a new window, got %v", w)
+	}
+}
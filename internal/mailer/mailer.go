@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends transactional email. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Format renders msg as an RFC 5322 plain text message.
+func Format(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("mail header contains a line break")
+		}
+	}
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@chirpy>\r\n", uuid.New())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
+
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer authenticates with PLAIN auth when a username is given.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	mailer := &SMTPMailer{
+		Addr: net.JoinHostPort(host, port),
+		From: from,
+	}
+	if username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	sender, err := EnvelopeSender(m.From)
+	if err != nil {
+		return err
+	}
+	data, err := Format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, sender, []string{msg.To}, data)
+}
+
+// EnvelopeSender returns the bare address of a From header such as
+// "Chirpy <no-reply@example.com>", which is what SMTP's MAIL FROM expects.
+func EnvelopeSender(from string) (string, error) {
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return "", fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	return addr.Address, nil
+}
+
+// MemoryMailer keeps every message in memory. It is meant for tests and
+// local development.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message{}, m.messages...)
+}
+
+// FileMailer writes every message as an .eml file into Dir. Mails carry
+// login links, so only the server's own user may read them.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := Format(m.From, msg, now)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), uuid.New())
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
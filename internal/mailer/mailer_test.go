@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	t.Run("renders headers and body", func(t *testing.T) {
+		data, err := Format("chirpy@example.com", Message{
+			To:      "user@example.com",
+			Subject: "Verify your email",
+			Body:    "line one\nline two",
+		}, time.Now())
+		if err != nil {
+			t.Fatal("failed to format message:", err)
+		}
+		got := string(data)
+		for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "Subject: Verify your email\r\n", "\r\n\r\nline one\r\nline two"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected message to contain %q, got %q", want, got)
+			}
+		}
+	})
+
+	t.Run("rejects header injection", func(t *testing.T) {
+		_, err := Format("chirpy@example.com", Message{
+			To:      "user@example.com\r\nBcc: victim@example.com",
+			Subject: "hi",
+		}, time.Now())
+		if err == nil {
+			t.Errorf("Expected header injection to be rejected")
+		}
+	})
+}
+
+func TestEnvelopeSender(t *testing.T) {
+	cases := map[string]string{
+		"Chirpy <no-reply@example.com>": "no-reply@example.com",
+		"no-reply@example.com":          "no-reply@example.com",
+	}
+	for from, want := range cases {
+		got, err := EnvelopeSender(from)
+		if err != nil {
+			t.Errorf("EnvelopeSender(%q) failed: %v", from, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("EnvelopeSender(%q) = %q, expected %q", from, got, want)
+		}
+	}
+	_, err := EnvelopeSender("Chirpy")
+	if err == nil {
+		t.Errorf("Expected a sender without address to be rejected")
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := &MemoryMailer{}
+	mailer.Send(context.Background(), Message{To: "a@example.com", Subject: "one"})
+	mailer.Send(context.Background(), Message{To: "b@example.com", Subject: "two"})
+
+	messages := mailer.Messages()
+	if len(messages) != 2 || messages[1].To != "b@example.com" {
+		t.Errorf("Unexpected messages: %+v", messages)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: filepath.Join(dir, "mail"), From: "chirpy@example.com"}
+	err := mailer.Send(context.Background(), Message{To: "a@example.com", Subject: "hello", Body: "body"})
+	if err != nil {
+		t.Fatal("failed to send:", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "mail", "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one .eml file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "Subject: hello") {
+		t.Errorf("Unexpected file content: %q", data)
+	}
+	info, _ := os.Stat(files[0])
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected mail to be readable by the owner only, got %v", perm)
+	}
+	info, _ = os.Stat(filepath.Join(dir, "mail"))
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("Expected mail directory to be private, got %v", perm)
+	}
+}
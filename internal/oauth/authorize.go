@@ -0,0 +1,230 @@
+package oauth
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+var scopeDescriptions = map[string]string{
+	ScopeOpenID:            "Confirm who you are on Chirpy",
+	ScopeEmail:             "See your email address",
+	auth.ScopeChirpsWrite:  "Post chirps as you",
+	auth.ScopeChirpsDelete: "Delete your chirps",
+	auth.ScopeUsersRead:    "See your sessions, keys, notifications and follows",
+	auth.ScopeUsersWrite:   "Change your account and follows",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8">
+		<title>Authorize {{.Client.Name}} - Chirpy</title>
+	</head>
+	<body>
+		<h1>{{.Client.Name}} wants to access your Chirpy account</h1>
+		<p>It will be able to:</p>
+		<ul>
+			{{range .Scopes}}<li>{{.}}</li>
+			{{end}}
+		</ul>
+		<p>You will be sent back to {{.RedirectURI}}.</p>
+		{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+		<form method="post" action="/oauth/authorize">
+			{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+			{{end}}{{end}}
+			<label>Email <input type="email" name="email" autocomplete="username" required></label>
+			<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+			<label>Two-factor code, if enabled <input type="text" name="code" autocomplete="one-time-code" inputmode="numeric"></label>
+			<button type="submit" name="action" value="approve">Allow</button>
+			<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+		</form>
+	</body>
+</html>
+`))
+
+// authRequest is a validated authorization request.
+type authRequest struct {
+	client Client
+	// redirectURI is the URI the response goes to; requestedURI is the
+	// redirect_uri parameter, which may be empty for clients with a single
+	// registered URI.
+	redirectURI   string
+	requestedURI  string
+	scopes        []string
+	state         string
+	nonce         string
+	codeChallenge string
+	// params are the OAuth parameters, carried through the consent form.
+	params url.Values
+}
+
+// parseAuthRequest validates an authorization request. Errors about the
+// client or redirect URI are returned as plain errors and must be shown to
+// the user; any later *Error is sent to the client's redirect URI.
+func (s *Server) parseAuthRequest(req *http.Request, values url.Values) (*authRequest, error) {
+	client, err := s.Store.GetClient(req.Context(), values.Get("client_id"))
+	if err != nil {
+		return nil, errors.New("Unknown client")
+	}
+	ar := &authRequest{
+		client:       client,
+		requestedURI: values.Get("redirect_uri"),
+		state:        values.Get("state"),
+		nonce:        values.Get("nonce"),
+		params:       url.Values{},
+	}
+	switch {
+	case ar.requestedURI != "" && slices.Contains(client.RedirectURIs, ar.requestedURI):
+		ar.redirectURI = ar.requestedURI
+	case ar.requestedURI == "" && len(client.RedirectURIs) == 1:
+		ar.redirectURI = client.RedirectURIs[0]
+	default:
+		return nil, errors.New("The redirect URI is not registered for this client")
+	}
+	for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+		if values.Has(name) {
+			ar.params.Set(name, values.Get(name))
+		}
+	}
+
+	if values.Get("response_type") != "code" {
+		return ar, newError(400, "unsupported_response_type", "Only the code response type is supported")
+	}
+	ar.codeChallenge = values.Get("code_challenge")
+	if ar.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return ar, newError(400, "invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	if values.Has("scope") {
+		ar.scopes, err = parseScopes(values.Get("scope"), client.Scopes)
+		if err != nil {
+			return ar, newError(400, "invalid_scope", err.Error())
+		}
+	} else {
+		ar.scopes = client.Scopes
+	}
+	if len(ar.scopes) == 0 {
+		return ar, newError(400, "invalid_scope", "No scope requested")
+	}
+	return ar, nil
+}
+
+// redirect sends the authorization response to the client. iss lets the
+// client tell responses of different servers apart (RFC 9207).
+func (s *Server) redirect(w http.ResponseWriter, req *http.Request, ar *authRequest, params url.Values) {
+	u, _ := url.Parse(ar.redirectURI)
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if ar.state != "" {
+		query.Set("state", ar.state)
+	}
+	query.Set("iss", s.Issuer)
+	u.RawQuery = query.Encode()
+	http.Redirect(w, req, u.String(), http.StatusSeeOther)
+}
+
+func (s *Server) redirectError(w http.ResponseWriter, req *http.Request, ar *authRequest, oauthErr *Error) {
+	s.redirect(w, req, ar, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+func (s *Server) renderConsent(w http.ResponseWriter, status int, ar *authRequest, message string) {
+	scopes := []string{}
+	for _, scope := range ar.scopes {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+	// The consent screen must not be framed by the client to trick users
+	// into clicking Allow.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := consentTemplate.Execute(w, map[string]any{
+		"Client":      ar.client,
+		"Scopes":      scopes,
+		"RedirectURI": ar.redirectURI,
+		"Params":      ar.params,
+		"Error":       message,
+	})
+	if err != nil {
+		log.Printf("oauth: rendering consent screen: %v", err)
+	}
+}
+
+// AuthorizeHandler shows the consent screen on GET and handles the user's
+// decision on POST. The user signs in on the consent form itself, so the
+// client never sees their credentials.
+func (s *Server) AuthorizeHandler(w http.ResponseWriter, req *http.Request) {
+	values := req.URL.Query()
+	if req.Method == http.MethodPost {
+		err := req.ParseForm()
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		values = req.PostForm
+	}
+
+	ar, err := s.parseAuthRequest(req, values)
+	var oauthErr *Error
+	if errors.As(err, &oauthErr) {
+		s.redirectError(w, req, ar, oauthErr)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if req.Method != http.MethodPost {
+		s.renderConsent(w, 200, ar, "")
+		return
+	}
+
+	if values.Get("action") != "approve" {
+		s.redirectError(w, req, ar, newError(403, "access_denied", "The user denied access"))
+		return
+	}
+	userID, err := s.Login(req)
+	if err != nil {
+		s.renderConsent(w, 401, ar, err.Error())
+		return
+	}
+
+	code, codeHash, err := randomToken()
+	if err != nil {
+		s.redirectError(w, req, ar, newError(500, "server_error", "Failed to create code"))
+		return
+	}
+	now := s.Now()
+	err = s.Store.CreateCode(req.Context(), Code{
+		Hash:          codeHash,
+		ClientID:      ar.client.ID,
+		UserID:        userID,
+		GrantID:       uuid.New(),
+		RedirectURI:   ar.requestedURI,
+		Scopes:        ar.scopes,
+		CodeChallenge: ar.codeChallenge,
+		Nonce:         ar.nonce,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.CodeTTL),
+	})
+	if err != nil {
+		log.Printf("oauth: storing code for client %s: %v", ar.client.ID, err)
+		s.redirectError(w, req, ar, newError(500, "server_error", "Failed to store code"))
+		return
+	}
+	s.redirect(w, req, ar, url.Values{"code": {code}})
+}
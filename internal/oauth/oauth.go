@@ -0,0 +1,223 @@
+// Package oauth implements an OAuth 2.1 authorization server with the
+// authorization code flow, PKCE and OpenID Connect on top of it. Access
+// tokens are regular Chirpy access tokens signed by an auth.KeySet.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+// OpenID Connect scopes. openid asks for an ID token, email for the user's
+// email address in the ID token and from the userinfo endpoint.
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// SupportedScopes are the scopes a client can be registered for. The admin
+// scope is never handed to third parties.
+var SupportedScopes = []string{
+	ScopeOpenID,
+	ScopeEmail,
+	auth.ScopeChirpsWrite,
+	auth.ScopeChirpsDelete,
+	auth.ScopeUsersRead,
+	auth.ScopeUsersWrite,
+}
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrReused is returned by the Store together with the code or refresh
+	// token when it had been used before.
+	ErrReused = errors.New("already used")
+)
+
+// Client is a registered third-party application. Public clients, e.g.
+// mobile or single page apps, cannot keep a secret and have none.
+type Client struct {
+	ID           string
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	OwnerID      uuid.UUID
+	CreatedAt    time.Time
+}
+
+func (c Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// Code is an authorization code. Only its hash is stored.
+type Code struct {
+	Hash     string
+	ClientID string
+	UserID   uuid.UUID
+	// GrantID ties together the tokens issued for one authorization so
+	// they can be revoked together.
+	GrantID       uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time
+	ExpiresAt     time.Time
+}
+
+// RefreshToken is an OAuth refresh token. Like the code only its hash is
+// stored; every use rotates it.
+type RefreshToken struct {
+	Hash      string
+	ClientID  string
+	UserID    uuid.UUID
+	GrantID   uuid.UUID
+	Scopes    []string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// UserInfo is what the userinfo endpoint and ID tokens tell clients about a
+// user.
+type UserInfo struct {
+	Email         string
+	EmailVerified bool
+}
+
+// Store is the persistence the Server needs. The server backs it with
+// Postgres, tests with an in-memory implementation.
+type Store interface {
+	CreateClient(ctx context.Context, client Client) error
+	GetClient(ctx context.Context, clientID string) (Client, error)
+	CreateCode(ctx context.Context, code Code) error
+	// UseCode marks a code used and returns it. A code used before is
+	// returned with ErrReused.
+	UseCode(ctx context.Context, hash string) (Code, error)
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	// UseRefreshToken marks a refresh token used and returns it. A token
+	// used before is returned with ErrReused.
+	UseRefreshToken(ctx context.Context, hash string) (RefreshToken, error)
+	// RevokeGrant revokes every refresh token of a grant.
+	RevokeGrant(ctx context.Context, grantID uuid.UUID) error
+	UserInfo(ctx context.Context, userID uuid.UUID) (UserInfo, error)
+}
+
+// randomToken returns a random code, token or secret and its storage hash.
+func randomToken() (string, string, error) {
+	data := make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyPKCE checks an S256 code verifier against the challenge of the
+// authorization request. The plain method is not supported.
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment and, for
+// apps running on the user's machine, http URIs on the loopback interface.
+func validRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must be absolute and have no fragment", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must use https", raw)
+}
+
+// parseScopes splits a scope parameter and checks every scope is allowed.
+func parseScopes(scope string, allowed []string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("scope %q is not allowed", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// NewClient validates a client registration and returns the client with a
+// fresh ID and, for confidential clients, the plain secret. The secret is
+// not stored and cannot be shown again.
+func NewClient(ownerID uuid.UUID, name string, redirectURIs, scopes []string, public bool) (Client, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return Client{}, "", errors.New("name must be between 1 and 100 characters")
+	}
+	if len(redirectURIs) == 0 {
+		return Client{}, "", errors.New("at least one redirect URI is required")
+	}
+	for _, uri := range redirectURIs {
+		err := validRedirectURI(uri)
+		if err != nil {
+			return Client{}, "", err
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = SupportedScopes
+	}
+	scopes, err := parseScopes(strings.Join(scopes, " "), SupportedScopes)
+	if err != nil {
+		return Client{}, "", err
+	}
+
+	client := Client{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		OwnerID:      ownerID,
+		CreatedAt:    time.Now(),
+	}
+	if public {
+		return client, "", nil
+	}
+	secret, secretHash, err := randomToken()
+	if err != nil {
+		return Client{}, "", err
+	}
+	client.SecretHash = secretHash
+	return client, secret, nil
+}
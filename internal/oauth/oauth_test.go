@@ -0,0 +1,508 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type memCode struct {
+	Code
+	used bool
+}
+
+type memRefreshToken struct {
+	RefreshToken
+	used bool
+}
+
+type memStore struct {
+	mu      sync.Mutex
+	clients map[string]Client
+	codes   map[string]*memCode
+	tokens  map[string]*memRefreshToken
+	users   map[uuid.UUID]UserInfo
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		clients: map[string]Client{},
+		codes:   map[string]*memCode{},
+		tokens:  map[string]*memRefreshToken{},
+		users:   map[uuid.UUID]UserInfo{},
+	}
+}
+
+func (s *memStore) CreateClient(ctx context.Context, client Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+	return nil
+}
+
+func (s *memStore) GetClient(ctx context.Context, clientID string) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[clientID]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *memStore) CreateCode(ctx context.Context, code Code) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code.Hash] = &memCode{Code: code}
+	return nil
+}
+
+func (s *memStore) UseCode(ctx context.Context, hash string) (Code, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[hash]
+	if !ok {
+		return Code{}, ErrNotFound
+	}
+	if code.used {
+		return code.Code, ErrReused
+	}
+	code.used = true
+	return code.Code, nil
+}
+
+func (s *memStore) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = &memRefreshToken{RefreshToken: token}
+	return nil
+}
+
+func (s *memStore) GetRefreshToken(ctx context.Context, hash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return token.RefreshToken, nil
+}
+
+func (s *memStore) UseRefreshToken(ctx context.Context, hash string) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	if token.used {
+		return token.RefreshToken, ErrReused
+	}
+	token.used = true
+	return token.RefreshToken, nil
+}
+
+func (s *memStore) RevokeGrant(ctx context.Context, grantID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range s.tokens {
+		if token.GrantID == grantID {
+			token.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (s *memStore) UserInfo(ctx context.Context, userID uuid.UUID) (UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.users[userID]
+	if !ok {
+		return UserInfo{}, ErrNotFound
+	}
+	return info, nil
+}
+
+const testPassword = "hunter2"
+
+type testEnv struct {
+	server *httptest.Server
+	store  *memStore
+	keys   *auth.KeySet
+	userID uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	env := &testEnv{store: newMemStore(), keys: auth.NewHMACKeySet("test-secret"), userID: uuid.New()}
+	env.store.users[env.userID] = UserInfo{Email: "walt@breakingbad.com", EmailVerified: true}
+
+	mux := http.NewServeMux()
+	env.server = httptest.NewServer(mux)
+	t.Cleanup(env.server.Close)
+	s := NewServer(env.store, env.keys, env.server.URL, func(req *http.Request) (uuid.UUID, error) {
+		if req.PostForm.Get("email") != "walt@breakingbad.com" || req.PostForm.Get("password") != testPassword {
+			return uuid.Nil, errors.New("Incorrect email or password")
+		}
+		return env.userID, nil
+	})
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.DiscoveryHandler)
+	mux.HandleFunc("GET /oauth/authorize", s.AuthorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", s.AuthorizeHandler)
+	mux.HandleFunc("POST /oauth/token", s.TokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", s.RevokeHandler)
+	mux.HandleFunc("GET /oauth/userinfo", s.UserInfoHandler)
+	return env
+}
+
+// fakeClient plays a third-party app doing the authorization code flow.
+type fakeClient struct {
+	env         *testEnv
+	client      Client
+	secret      string
+	redirectURI string
+	http        *http.Client
+}
+
+func (env *testEnv) newClient(t *testing.T, public bool) *fakeClient {
+	redirectURI := "https://app.example/callback"
+	client, secret, err := NewClient(uuid.New(), "Breaking Bot", []string{redirectURI}, nil, public)
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+	env.store.CreateClient(context.Background(), client)
+	return &fakeClient{
+		env:         env,
+		client:      client,
+		secret:      secret,
+		redirectURI: redirectURI,
+		// The redirect goes to the app, which does not exist here.
+		http: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+func pkcePair() (string, string) {
+	verifier := strings.Repeat("v", 20) + uuid.NewString()
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (c *fakeClient) authorizeParams(scope, challenge string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.client.ID},
+		"redirect_uri":          {c.redirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+// consent submits the consent form and returns the query of the redirect
+// back to the app.
+func (c *fakeClient) consent(t *testing.T, params url.Values, action, password string) url.Values {
+	form := url.Values{}
+	for name, values := range params {
+		form[name] = values
+	}
+	form.Set("action", action)
+	form.Set("email", "walt@breakingbad.com")
+	form.Set("password", password)
+	res, err := c.http.PostForm(c.env.server.URL+"/oauth/authorize", form)
+	if err != nil {
+		t.Fatal("failed to submit consent:", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("Expected redirect after consent, got %d", res.StatusCode)
+	}
+	location, _ := url.Parse(res.Header.Get("Location"))
+	if location.Scheme+"://"+location.Host+location.Path != c.redirectURI {
+		t.Fatalf("Redirected to unexpected URI %v", location)
+	}
+	return location.Query()
+}
+
+func (c *fakeClient) token(t *testing.T, form url.Values) (int, map[string]any) {
+	if c.client.Public() {
+		form.Set("client_id", c.client.ID)
+	}
+	req, _ := http.NewRequest("POST", c.env.server.URL+"/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !c.client.Public() {
+		req.SetBasicAuth(c.client.ID, c.secret)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal("token request failed:", err)
+	}
+	defer res.Body.Close()
+	body := map[string]any{}
+	json.NewDecoder(res.Body).Decode(&body)
+	return res.StatusCode, body
+}
+
+// login runs the whole flow and returns the token response.
+func (c *fakeClient) login(t *testing.T, scope string) map[string]any {
+	verifier, challenge := pkcePair()
+	query := c.consent(t, c.authorizeParams(scope, challenge), "approve", testPassword)
+	if query.Get("state") != "xyz" || query.Get("iss") != c.env.server.URL {
+		t.Fatalf("Unexpected authorization response %v", query)
+	}
+	status, body := c.token(t, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {c.redirectURI},
+		"code_verifier": {verifier},
+	})
+	if status != 200 {
+		t.Fatalf("Expected tokens, got %d %v", status, body)
+	}
+	return body
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.newClient(t, false)
+
+	res, err := http.Get(env.server.URL + "/oauth/authorize?" + c.authorizeParams("openid email chirps:write", "challenge").Encode())
+	if err != nil {
+		t.Fatal("failed to load consent screen:", err)
+	}
+	page, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 || !strings.Contains(string(page), "Breaking Bot") || res.Header.Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("Unexpected consent screen %d: %s", res.StatusCode, page)
+	}
+
+	tokens := c.login(t, "openid email chirps:write")
+	claims, err := env.keys.ValidateJWT(tokens["access_token"].(string))
+	if err != nil {
+		t.Fatal("Expected access token to pass auth.ValidateJWT:", err)
+	}
+	if claims.UserID != env.userID || claims.ClientID != c.client.ID {
+		t.Errorf("Unexpected access token claims %+v", claims)
+	}
+	if !claims.HasScope(auth.ScopeChirpsWrite) || claims.HasScope(auth.ScopeUsersWrite) {
+		t.Errorf("Unexpected scopes %q", claims.Scope)
+	}
+
+	idClaims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(tokens["id_token"].(string), idClaims, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	}, jwt.WithIssuer(env.server.URL), jwt.WithAudience(c.client.ID))
+	if err != nil {
+		t.Fatal("Invalid ID token:", err)
+	}
+	if idClaims.Nonce != "n-0S6" || idClaims.Email != "walt@breakingbad.com" || idClaims.Subject != env.userID.String() {
+		t.Errorf("Unexpected ID token claims %+v", idClaims)
+	}
+
+	req, _ := http.NewRequest("GET", env.server.URL+"/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("userinfo request failed:", err)
+	}
+	info := map[string]any{}
+	json.NewDecoder(res.Body).Decode(&info)
+	res.Body.Close()
+	if info["sub"] != env.userID.String() || info["email"] != "walt@breakingbad.com" {
+		t.Errorf("Unexpected userinfo %v", info)
+	}
+}
+
+func TestAuthorizationCodeRejects(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.newClient(t, false)
+
+	t.Run("wrong code verifier", func(t *testing.T) {
+		_, challenge := pkcePair()
+		query := c.consent(t, c.authorizeParams("chirps:write", challenge), "approve", testPassword)
+		other, _ := pkcePair()
+		status, body := c.token(t, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {query.Get("code")},
+			"redirect_uri":  {c.redirectURI},
+			"code_verifier": {other},
+		})
+		if status != 400 || body["error"] != "invalid_grant" {
+			t.Errorf("Expected invalid_grant, got %d %v", status, body)
+		}
+	})
+
+	t.Run("code used twice revokes the grant", func(t *testing.T) {
+		verifier, challenge := pkcePair()
+		query := c.consent(t, c.authorizeParams("chirps:write", challenge), "approve", testPassword)
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {query.Get("code")},
+			"redirect_uri":  {c.redirectURI},
+			"code_verifier": {verifier},
+		}
+		_, tokens := c.token(t, form)
+		if status, _ := c.token(t, form); status != 400 {
+			t.Errorf("Expected second use of the code to fail, got %d", status)
+		}
+		status, _ := c.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens["refresh_token"].(string)}})
+		if status != 400 {
+			t.Errorf("Expected refresh token of a replayed code to be revoked, got %d", status)
+		}
+	})
+
+	t.Run("user denies", func(t *testing.T) {
+		_, challenge := pkcePair()
+		query := c.consent(t, c.authorizeParams("chirps:write", challenge), "deny", "")
+		if query.Get("error") != "access_denied" || query.Has("code") {
+			t.Errorf("Expected access_denied, got %v", query)
+		}
+	})
+
+	t.Run("unknown scope", func(t *testing.T) {
+		_, challenge := pkcePair()
+		query := c.consent(t, c.authorizeParams("admin", challenge), "approve", testPassword)
+		if query.Get("error") != "invalid_scope" {
+			t.Errorf("Expected invalid_scope, got %v", query)
+		}
+	})
+
+	t.Run("wrong password shows the form again", func(t *testing.T) {
+		_, challenge := pkcePair()
+		form := c.authorizeParams("chirps:write", challenge)
+		form.Set("action", "approve")
+		form.Set("email", "walt@breakingbad.com")
+		form.Set("password", "wrong")
+		res, err := c.http.PostForm(env.server.URL+"/oauth/authorize", form)
+		if err != nil {
+			t.Fatal("failed to submit consent:", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 401 {
+			t.Errorf("Expected 401, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("unregistered redirect URI is not followed", func(t *testing.T) {
+		_, challenge := pkcePair()
+		params := c.authorizeParams("chirps:write", challenge)
+		params.Set("redirect_uri", "https://evil.example/callback")
+		res, err := c.http.Get(env.server.URL + "/oauth/authorize?" + params.Encode())
+		if err != nil {
+			t.Fatal("request failed:", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 400 {
+			t.Errorf("Expected 400, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("wrong client secret", func(t *testing.T) {
+		wrong := *c
+		wrong.secret = "nope"
+		status, body := wrong.token(t, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"x"}})
+		if status != 401 || body["error"] != "invalid_client" {
+			t.Errorf("Expected invalid_client, got %d %v", status, body)
+		}
+	})
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	env := newTestEnv(t)
+	c := env.newClient(t, true)
+	tokens := c.login(t, "chirps:write chirps:delete")
+
+	status, refreshed := c.token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+		"scope":         {"chirps:write"},
+	})
+	if status != 200 || refreshed["scope"] != "chirps:write" {
+		t.Fatalf("Expected narrowed refresh, got %d %v", status, refreshed)
+	}
+	if _, id_token := refreshed["id_token"]; id_token {
+		t.Errorf("Expected no ID token without the openid scope")
+	}
+
+	status, _ = c.token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	})
+	if status != 400 {
+		t.Errorf("Expected reuse of a rotated refresh token to fail, got %d", status)
+	}
+	status, _ = c.token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshed["refresh_token"].(string)},
+	})
+	if status != 400 {
+		t.Errorf("Expected reuse to revoke the whole grant, got %d", status)
+	}
+
+	tokens = c.login(t, "chirps:write")
+	res, err := c.http.PostForm(env.server.URL+"/oauth/revoke", url.Values{
+		"client_id": {c.client.ID},
+		"token":     {tokens["refresh_token"].(string)},
+	})
+	if err != nil {
+		t.Fatal("revoke request failed:", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("Expected 200 from revoke, got %d", res.StatusCode)
+	}
+	status, _ = c.token(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	})
+	if status != 400 {
+		t.Errorf("Expected revoked refresh token to fail, got %d", status)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	env := newTestEnv(t)
+	res, err := http.Get(env.server.URL + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal("discovery request failed:", err)
+	}
+	defer res.Body.Close()
+	doc := map[string]any{}
+	json.NewDecoder(res.Body).Decode(&doc)
+	if doc["issuer"] != env.server.URL || doc["token_endpoint"] != env.server.URL+"/oauth/token" {
+		t.Errorf("Unexpected discovery document %v", doc)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	owner := uuid.New()
+	if _, _, err := NewClient(owner, "App", []string{"http://app.example/callback"}, nil, false); err == nil {
+		t.Errorf("Expected plain http redirect URI to be rejected")
+	}
+	if _, _, err := NewClient(owner, "App", []string{"https://app.example/callback"}, []string{"admin"}, false); err == nil {
+		t.Errorf("Expected admin scope to be rejected")
+	}
+	client, secret, err := NewClient(owner, "App", []string{"http://127.0.0.1:8000/callback"}, nil, false)
+	if err != nil || secret == "" || client.SecretHash != hashToken(secret) {
+		t.Errorf("Unexpected client %+v, %v (%v)", client, secret, err)
+	}
+	verifier, challenge := pkcePair()
+	if !verifyPKCE(challenge, verifier) || verifyPKCE(challenge, verifier+"x") {
+		t.Errorf("Unexpected PKCE verification result")
+	}
+}
@@ -0,0 +1,96 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Server serves the OAuth endpoints. Mount its handlers on:
+//
+//	GET  /.well-known/openid-configuration  DiscoveryHandler
+//	GET  /oauth/authorize                   AuthorizeHandler (consent screen)
+//	POST /oauth/authorize                   AuthorizeHandler (consent decision)
+//	POST /oauth/token                       TokenHandler
+//	POST /oauth/revoke                      RevokeHandler
+//	GET  /oauth/userinfo                    UserInfoHandler
+type Server struct {
+	Store Store
+	Keys  *auth.KeySet
+	// Issuer is the public base URL the endpoints are served under, e.g.
+	// https://chirpy.example. It is the iss of ID tokens; access tokens
+	// keep Chirpy's usual issuer so auth.ValidateJWT accepts them.
+	Issuer string
+	// Login authenticates the user from the consent form. It returns the
+	// error to show on the form when the credentials are wrong.
+	Login           func(req *http.Request) (uuid.UUID, error)
+	CodeTTL         time.Duration
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Now             func() time.Time
+}
+
+func NewServer(store Store, keys *auth.KeySet, issuer string, login func(req *http.Request) (uuid.UUID, error)) *Server {
+	return &Server{
+		Store:           store,
+		Keys:            keys,
+		Issuer:          issuer,
+		Login:           login,
+		CodeTTL:         time.Minute,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+		Now:             time.Now,
+	}
+}
+
+// Error is an OAuth error response as defined in RFC 6749 section 5.2.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newError(status int, code, description string) *Error {
+	return &Error{Code: code, Description: description, status: status}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	data, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	writeJSON(w, err.status, err)
+}
+
+// DiscoveryHandler serves the OpenID Connect discovery document.
+func (s *Server) DiscoveryHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, 200, map[string]any{
+		"issuer":                                         s.Issuer,
+		"authorization_endpoint":                         s.Issuer + "/oauth/authorize",
+		"token_endpoint":                                 s.Issuer + "/oauth/token",
+		"revocation_endpoint":                            s.Issuer + "/oauth/revoke",
+		"userinfo_endpoint":                              s.Issuer + "/oauth/userinfo",
+		"jwks_uri":                                       s.Issuer + "/.well-known/jwks.json",
+		"scopes_supported":                               SupportedScopes,
+		"response_types_supported":                       []string{"code"},
+		"response_modes_supported":                       []string{"query"},
+		"grant_types_supported":                          []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":               []string{"S256"},
+		"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+		"subject_types_supported":                        []string{"public"},
+		"id_token_signing_alg_values_supported":          []string{s.Keys.SigningAlg()},
+		"claims_supported":                               []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+		"authorization_response_iss_parameter_supported": true,
+	})
+}
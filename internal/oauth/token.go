@@ -0,0 +1,310 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// idTokenClaims are the claims of an OpenID Connect ID token.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthTime      int64  `json:"auth_time"`
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// grant is what tokens are issued for, from a code or a refresh token.
+type grant struct {
+	userID   uuid.UUID
+	grantID  uuid.UUID
+	scopes   []string
+	authTime time.Time
+	nonce    string
+}
+
+// authenticateClient identifies the client of a token or revocation request
+// by HTTP Basic authentication or form parameters. Public clients only send
+// their ID.
+func (s *Server) authenticateClient(req *http.Request) (Client, *Error) {
+	clientID, secret, basic := req.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes both before Basic encoding.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+	invalid := newError(401, "invalid_client", "Client authentication failed")
+	if clientID == "" {
+		return Client{}, invalid
+	}
+	client, err := s.Store.GetClient(req.Context(), clientID)
+	if err != nil {
+		return Client{}, invalid
+	}
+	if client.Public() {
+		if secret != "" {
+			return Client{}, invalid
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return Client{}, invalid
+	}
+	return client, nil
+}
+
+// TokenHandler exchanges authorization codes and refresh tokens for access
+// tokens.
+func (s *Server) TokenHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		writeError(w, newError(400, "invalid_request", err.Error()))
+		return
+	}
+	client, oauthErr := s.authenticateClient(req)
+	if oauthErr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		writeError(w, oauthErr)
+		return
+	}
+
+	var g grant
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		g, oauthErr = s.exchangeCode(req, client)
+	case "refresh_token":
+		g, oauthErr = s.exchangeRefreshToken(req, client)
+	default:
+		oauthErr = newError(400, "unsupported_grant_type", "Only authorization_code and refresh_token are supported")
+	}
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+	s.issueTokens(w, req, client, g)
+}
+
+func (s *Server) exchangeCode(req *http.Request, client Client) (grant, *Error) {
+	invalid := newError(400, "invalid_grant", "Invalid, expired or used authorization code")
+	code, err := s.Store.UseCode(req.Context(), hashToken(req.PostForm.Get("code")))
+	if errors.Is(err, ErrReused) {
+		// A code used twice was probably stolen; the tokens issued for
+		// its first use cannot be trusted either.
+		s.revokeGrant(req, code.GrantID)
+		return grant{}, invalid
+	}
+	if err != nil {
+		return grant{}, invalid
+	}
+	if code.ClientID != client.ID || !s.Now().Before(code.ExpiresAt) {
+		return grant{}, invalid
+	}
+	if req.PostForm.Get("redirect_uri") != code.RedirectURI {
+		return grant{}, newError(400, "invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCE(code.CodeChallenge, req.PostForm.Get("code_verifier")) {
+		return grant{}, newError(400, "invalid_grant", "code_verifier does not match the code challenge")
+	}
+	return grant{
+		userID:   code.UserID,
+		grantID:  code.GrantID,
+		scopes:   code.Scopes,
+		authTime: code.AuthTime,
+		nonce:    code.Nonce,
+	}, nil
+}
+
+func (s *Server) exchangeRefreshToken(req *http.Request, client Client) (grant, *Error) {
+	invalid := newError(400, "invalid_grant", "Invalid, expired or revoked refresh token")
+	token, err := s.Store.UseRefreshToken(req.Context(), hashToken(req.PostForm.Get("refresh_token")))
+	if errors.Is(err, ErrReused) && token.ClientID == client.ID {
+		// Rotated tokens are never used again by the legitimate client.
+		s.revokeGrant(req, token.GrantID)
+		return grant{}, invalid
+	}
+	if err != nil {
+		return grant{}, invalid
+	}
+	if token.ClientID != client.ID || token.Revoked || !s.Now().Before(token.ExpiresAt) {
+		return grant{}, invalid
+	}
+	scopes := token.Scopes
+	if req.PostForm.Has("scope") {
+		scopes, err = parseScopes(req.PostForm.Get("scope"), token.Scopes)
+		if err != nil {
+			return grant{}, newError(400, "invalid_scope", err.Error())
+		}
+	}
+	return grant{
+		userID:   token.UserID,
+		grantID:  token.GrantID,
+		scopes:   scopes,
+		authTime: token.AuthTime,
+	}, nil
+}
+
+func (s *Server) revokeGrant(req *http.Request, grantID uuid.UUID) {
+	err := s.Store.RevokeGrant(req.Context(), grantID)
+	if err != nil {
+		log.Printf("oauth: revoking grant %s: %v", grantID, err)
+	}
+}
+
+func (s *Server) issueTokens(w http.ResponseWriter, req *http.Request, client Client, g grant) {
+	type tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+		IDToken      string `json:"id_token,omitempty"`
+	}
+
+	claims := auth.NewClaims(g.userID, uuid.Nil, g.scopes, s.AccessTokenTTL)
+	claims.ClientID = client.ID
+	accessToken, err := s.Keys.Sign(claims)
+	if err != nil {
+		writeError(w, newError(500, "server_error", "Failed to sign access token"))
+		return
+	}
+
+	refreshToken, refreshHash, err := randomToken()
+	if err != nil {
+		writeError(w, newError(500, "server_error", "Failed to create refresh token"))
+		return
+	}
+	err = s.Store.CreateRefreshToken(req.Context(), RefreshToken{
+		Hash:      refreshHash,
+		ClientID:  client.ID,
+		UserID:    g.userID,
+		GrantID:   g.grantID,
+		Scopes:    g.scopes,
+		AuthTime:  g.authTime,
+		ExpiresAt: s.Now().Add(s.RefreshTokenTTL),
+	})
+	if err != nil {
+		log.Printf("oauth: storing refresh token for client %s: %v", client.ID, err)
+		writeError(w, newError(500, "server_error", "Failed to store refresh token"))
+		return
+	}
+
+	res_body := tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(g.scopes, " "),
+	}
+	if slices.Contains(g.scopes, ScopeOpenID) {
+		res_body.IDToken, err = s.idToken(req, client, g)
+		if err != nil {
+			log.Printf("oauth: creating ID token for client %s: %v", client.ID, err)
+			writeError(w, newError(500, "server_error", "Failed to create ID token"))
+			return
+		}
+	}
+	writeJSON(w, 200, res_body)
+}
+
+func (s *Server) idToken(req *http.Request, client Client, g grant) (string, error) {
+	now := s.Now()
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   g.userID.String(),
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.AccessTokenTTL)),
+		},
+		AuthTime: g.authTime.Unix(),
+		Nonce:    g.nonce,
+	}
+	if slices.Contains(g.scopes, ScopeEmail) {
+		info, err := s.Store.UserInfo(req.Context(), g.userID)
+		if err != nil {
+			return "", err
+		}
+		claims.Email = info.Email
+		claims.EmailVerified = &info.EmailVerified
+	}
+	return s.Keys.Sign(claims)
+}
+
+// RevokeHandler revokes a refresh token and with it the whole grant (RFC
+// 7009). Access tokens cannot be revoked and expire on their own. Unknown
+// tokens are not an error.
+func (s *Server) RevokeHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		writeError(w, newError(400, "invalid_request", err.Error()))
+		return
+	}
+	client, oauthErr := s.authenticateClient(req)
+	if oauthErr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		writeError(w, oauthErr)
+		return
+	}
+	token, err := s.Store.GetRefreshToken(req.Context(), hashToken(req.PostForm.Get("token")))
+	if err == nil && token.ClientID == client.ID {
+		err = s.Store.RevokeGrant(req.Context(), token.GrantID)
+		if err != nil {
+			writeError(w, newError(503, "temporarily_unavailable", "Failed to revoke token"))
+			return
+		}
+	}
+	w.WriteHeader(200)
+}
+
+// UserInfoHandler returns the claims about the user of an access token with
+// the openid scope.
+func (s *Server) UserInfoHandler(w http.ResponseWriter, req *http.Request) {
+	type userInfoResponse struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email,omitempty"`
+		EmailVerified *bool  `json:"email_verified,omitempty"`
+	}
+
+	bearerToken, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+		w.WriteHeader(401)
+		return
+	}
+	claims, err := s.Keys.ValidateJWT(bearerToken)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="invalid_token"`)
+		w.WriteHeader(401)
+		return
+	}
+	if !claims.HasScope(ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="insufficient_scope", scope="openid"`)
+		w.WriteHeader(403)
+		return
+	}
+
+	res_body := userInfoResponse{Sub: claims.UserID.String()}
+	if claims.HasScope(ScopeEmail) {
+		info, err := s.Store.UserInfo(req.Context(), claims.UserID)
+		if err != nil {
+			w.WriteHeader(401)
+			return
+		}
+		res_body.Email = info.Email
+		res_body.EmailVerified = &info.EmailVerified
+	}
+	writeJSON(w, 200, res_body)
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidFlow = errors.New("Login attempt is invalid or expired, please start again")
+
+// Flow is the state of one login attempt between sending the user to the
+// provider and the callback. It lives in a signed cookie so the callback
+// can check it belongs to the browser that started the login.
+type Flow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// LinkUserID is set when a signed in user links the identity to their
+	// account instead of logging in.
+	LinkUserID uuid.UUID `json:"link_user_id,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func randomString() (string, error) {
+	data := make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// NewFlow starts a login attempt at provider with fresh state, nonce and PKCE
+// verifier.
+func NewFlow(provider string, ttl time.Duration) (Flow, error) {
+	flow := Flow{Provider: provider, ExpiresAt: time.Now().Add(ttl)}
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		random, err := randomString()
+		if err != nil {
+			return Flow{}, err
+		}
+		*value = random
+	}
+	return flow, nil
+}
+
+func flowMAC(payload string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Seal encodes the flow for a cookie and signs it with key.
+func (f Flow) Seal(key []byte) string {
+	data, _ := json.Marshal(f)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + flowMAC(payload, key)
+}
+
+// OpenFlow verifies and decodes a sealed flow.
+func OpenFlow(sealed string, key []byte, now time.Time) (Flow, error) {
+	payload, mac, ok := strings.Cut(sealed, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(flowMAC(payload, key))) {
+		return Flow{}, ErrInvalidFlow
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Flow{}, ErrInvalidFlow
+	}
+	flow := Flow{}
+	err = json.Unmarshal(data, &flow)
+	if err != nil || !now.Before(flow.ExpiresAt) {
+		return Flow{}, ErrInvalidFlow
+	}
+	return flow, nil
+}
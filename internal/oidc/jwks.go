@@ -0,0 +1,151 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// supportedAlgs are the ID token algorithms accepted. HS256 is not: it would
+// make the client secret a signing key.
+var supportedAlgs = []string{"RS256", "ES256", "EdDSA"}
+
+type publicKey struct {
+	key any
+	alg string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() {
+			return nil, errors.New("weak or malformed RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("malformed Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// fetchKeys reads the provider's JWKS. Keys that cannot be used, e.g.
+// encryption keys, are skipped.
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]publicKey, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := p.getJSON(ctx, jwksURI, &document)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]publicKey{}
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+// key returns the signing key kid. Unknown key IDs make the provider fetch
+// its keys again, at most once per KeyRefreshInterval, so rotated keys are
+// picked up. Tokens without kid are accepted when the provider has a single
+// key.
+func (p *Provider) key(ctx context.Context, kid string) (publicKey, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return publicKey{}, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lookup := func() (publicKey, bool) {
+		if key, ok := p.keys[kid]; ok {
+			return key, true
+		}
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		return publicKey{}, false
+	}
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	if p.keys != nil && p.Now().Sub(p.keysFetched) < p.KeyRefreshInterval {
+		return publicKey{}, fmt.Errorf("unknown key ID %q", kid)
+	}
+	keys, err := p.fetchKeys(ctx, metadata.JWKSURI)
+	if err != nil {
+		return publicKey{}, err
+	}
+	p.keys = keys
+	p.keysFetched = p.Now()
+	if key, ok := lookup(); ok {
+		return key, nil
+	}
+	return publicKey{}, fmt.Errorf("unknown key ID %q", kid)
+}
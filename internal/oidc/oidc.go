@@ -0,0 +1,249 @@
+// Package oidc implements the relying party side of OpenID Connect: logging
+// users in with an external identity provider using the authorization code
+// flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config describes a client registration at an identity provider.
+type Config struct {
+	// Issuer is the provider's issuer URL; the discovery document is read
+	// from Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is Chirpy's callback registered at the provider.
+	RedirectURL string
+	// Scopes default to openid, email and profile.
+	Scopes []string
+}
+
+// Metadata is the part of the discovery document Chirpy uses.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken holds the verified claims Chirpy cares about.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// idTokenClaims are the raw ID token claims. email_verified is a string in
+// the tokens of some providers.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	AuthorizedFor string `json:"azp"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// Provider is a configured identity provider. Its discovery document and
+// keys are fetched on first use and cached.
+type Provider struct {
+	Config
+	Client *http.Client
+	Now    func() time.Time
+	// KeyRefreshInterval limits how often an unknown key ID makes the
+	// provider fetch its keys again.
+	KeyRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	keys        map[string]publicKey
+	keysFetched time.Time
+}
+
+func NewProvider(config Config) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		Config:             config,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		Now:                time.Now,
+		KeyRefreshInterval: time.Minute,
+	}
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("GET %s: status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
+
+// Discover returns the provider's metadata. The issuer in the document must
+// match the configured one, so a compromised document cannot redirect token
+// validation to another issuer.
+func (p *Provider) Discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	metadata := &Metadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", metadata)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if metadata.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", metadata.Issuer, p.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery: document lacks required endpoints")
+	}
+	p.metadata = metadata
+	return metadata, nil
+}
+
+// AuthCodeURL returns the URL to send the user to. The challenge is derived
+// from verifier, which must be kept for Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token issued with it.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*IDToken, error) {
+	type tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body := tokenResponse{}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("token response: %w", err)
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+	return p.VerifyIDToken(ctx, body.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's
+// keys, its issuer, audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := &idTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+		}
+		return key.key, nil
+	},
+		jwt.WithValidMethods(supportedAlgs),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(p.Now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedFor != p.ClientID {
+		return nil, errors.New("invalid ID token: issued for another party")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: no subject")
+	}
+
+	idToken := &IDToken{Subject: claims.Subject, Email: claims.Email, Name: claims.Name}
+	switch verified := claims.EmailVerified.(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		idToken.EmailVerified = verified == "true"
+	}
+	return idToken, nil
+}
@@ -0,0 +1,276 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP is a stand-in identity provider. Codes are handed out by the test
+// instead of a login page.
+type fakeIdP struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	kid    string
+	key    ed25519.PrivateKey
+	// published are the keys served from the JWKS endpoint.
+	published   map[string]ed25519.PublicKey
+	jwksFetches int
+	codes       map[string]fakeCode
+}
+
+type fakeCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	idp := &fakeIdP{published: map[string]ed25519.PublicKey{}, codes: map[string]fakeCode{}}
+	idp.rotate(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, req *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksFetches++
+		keys := []map[string]string{}
+		for kid, key := range idp.published {
+			keys = append(keys, map[string]string{
+				"kty": "OKP", "crv": "Ed25519", "kid": kid, "alg": "EdDSA", "use": "sig",
+				"x": base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("POST /token", idp.tokenHandler)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// rotate switches to a new signing key; the old key stays published.
+func (idp *fakeIdP) rotate(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.kid = base64.RawURLEncoding.EncodeToString(public[:8])
+	idp.key = private
+	idp.published[idp.kid] = public
+}
+
+func (idp *fakeIdP) sign(claims jwt.MapClaims) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = idp.kid
+	signed, _ := token.SignedString(idp.key)
+	return signed
+}
+
+// issueCode returns a code whose ID token carries the default claims for
+// client, overridden by claims.
+func (idp *fakeIdP) issueCode(authURL string, claims jwt.MapClaims) string {
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	defaults := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "staff-42",
+		"aud":            query.Get("client_id"),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          query.Get("nonce"),
+		"email":          "walt@breakingbad.com",
+		"email_verified": true,
+	}
+	for name, value := range claims {
+		defaults[name] = value
+	}
+	code, _ := randomString()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = fakeCode{challenge: query.Get("code_challenge"), claims: defaults}
+	return code
+}
+
+func (idp *fakeIdP) tokenHandler(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	clientID, secret, ok := req.BasicAuth()
+	if !ok || clientID != "chirpy" || secret != "s3cret" {
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	idp.mu.Lock()
+	code, ok := idp.codes[req.PostForm.Get("code")]
+	delete(idp.codes, req.PostForm.Get("code"))
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     idp.sign(code.claims),
+	})
+}
+
+func (idp *fakeIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       idp.server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://chirpy.example/api/login/oidc/corp/callback",
+	})
+}
+
+func TestLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := idp.provider()
+	ctx := context.Background()
+
+	login := func(t *testing.T, claims jwt.MapClaims) (*IDToken, error) {
+		flow, err := NewFlow("corp", time.Minute)
+		if err != nil {
+			t.Fatal("failed to start flow:", err)
+		}
+		authURL, err := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Verifier)
+		if err != nil {
+			t.Fatal("failed to build auth URL:", err)
+		}
+		if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") || !strings.Contains(authURL, "code_challenge_method=S256") {
+			t.Fatalf("Unexpected auth URL %v", authURL)
+		}
+		return p.Exchange(ctx, idp.issueCode(authURL, claims), flow.Verifier, flow.Nonce)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		idToken, err := login(t, nil)
+		if err != nil {
+			t.Fatal("Expected login to succeed:", err)
+		}
+		if idToken.Subject != "staff-42" || idToken.Email != "walt@breakingbad.com" || !idToken.EmailVerified {
+			t.Errorf("Unexpected ID token %+v", idToken)
+		}
+	})
+
+	t.Run("email_verified as string", func(t *testing.T) {
+		idToken, err := login(t, jwt.MapClaims{"email_verified": "false"})
+		if err != nil || idToken.EmailVerified {
+			t.Errorf("Expected unverified email, got %+v (%v)", idToken, err)
+		}
+	})
+
+	rejects := map[string]jwt.MapClaims{
+		"wrong nonce":    {"nonce": "replayed"},
+		"wrong audience": {"aud": "someone-else"},
+		"wrong issuer":   {"iss": "https://evil.example"},
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"foreign azp":    {"aud": []string{"chirpy", "other"}, "azp": "other"},
+	}
+	for name, claims := range rejects {
+		t.Run(name, func(t *testing.T) {
+			if _, err := login(t, claims); err == nil {
+				t.Errorf("Expected ID token to be rejected")
+			}
+		})
+	}
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		flow, _ := NewFlow("corp", time.Minute)
+		authURL, _ := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Verifier)
+		if _, err := p.Exchange(ctx, idp.issueCode(authURL, nil), "not-the-verifier", flow.Nonce); err == nil {
+			t.Errorf("Expected exchange with wrong verifier to fail")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := idp.provider()
+	now := time.Now()
+	p.Now = func() time.Time { return now }
+	ctx := context.Background()
+	claims := jwt.MapClaims{
+		"iss": idp.server.URL, "sub": "staff-42", "aud": "chirpy", "nonce": "n",
+		"exp": now.Add(time.Hour).Unix(), "iat": now.Unix(),
+	}
+
+	if _, err := p.VerifyIDToken(ctx, idp.sign(claims), "n"); err != nil {
+		t.Fatal("Expected token to verify:", err)
+	}
+	idp.rotate(t)
+	if _, err := p.VerifyIDToken(ctx, idp.sign(claims), "n"); err == nil {
+		t.Errorf("Expected keys not to be fetched again within the refresh interval")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := p.VerifyIDToken(ctx, idp.sign(claims), "n"); err != nil {
+		t.Errorf("Expected rotated key to be picked up: %v", err)
+	}
+	if idp.jwksFetches != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", idp.jwksFetches)
+	}
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	forged.Header["kid"] = idp.kid
+	signed, _ := forged.SignedString(other)
+	if _, err := p.VerifyIDToken(ctx, signed, "n"); err == nil {
+		t.Errorf("Expected token signed with a foreign key to be rejected")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	p := idp.provider()
+	p.Issuer = idp.server.URL + "/"
+	if _, err := p.Discover(context.Background()); err == nil {
+		t.Errorf("Expected issuer mismatch to be rejected")
+	}
+}
+
+func TestFlowSeal(t *testing.T) {
+	key := []byte("flow-key")
+	flow, err := NewFlow("corp", time.Minute)
+	if err != nil {
+		t.Fatal("failed to start flow:", err)
+	}
+	sealed := flow.Seal(key)
+	opened, err := OpenFlow(sealed, key, time.Now())
+	if err != nil || opened.State != flow.State || opened.Verifier != flow.Verifier {
+		t.Errorf("Expected flow to round trip, got %+v (%v)", opened, err)
+	}
+	if _, err := OpenFlow(sealed, []byte("other-key"), time.Now()); err == nil {
+		t.Errorf("Expected flow sealed with another key to be rejected")
+	}
+	if _, err := OpenFlow("x"+sealed, key, time.Now()); err == nil {
+		t.Errorf("Expected tampered flow to be rejected")
+	}
+	if _, err := OpenFlow(sealed, key, time.Now().Add(2*time.Minute)); err == nil {
+		t.Errorf("Expected expired flow to be rejected")
+	}
+}
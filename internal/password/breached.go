@@ -0,0 +1,109 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Corpus is a collection of passwords known to attackers.
+type Corpus interface {
+	Contains(password string) (bool, error)
+}
+
+// sha1Hex returns the upper case SHA-1 hex digest breach corpora are keyed by.
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// RangeDir is a breach corpus on disk indexed like the k-anonymity range API
+// of Have I Been Pwned: the file named after the first five hex digits of a
+// password's SHA-1 lists the remaining 35 digits of every breached hash with
+// that prefix, one "SUFFIX:COUNT" per line. A lookup reads only one small
+// file, and the files can be fetched range by range without ever revealing a
+// full hash.
+type RangeDir string
+
+func (d RangeDir) Contains(password string) (bool, error) {
+	hash := sha1Hex(password)
+	f, err := os.Open(filepath.Join(string(d), hash[:5]))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(suffix), hash[5:]) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// Set is a corpus held in memory, keyed by SHA-1 like RangeDir.
+type Set map[string]struct{}
+
+func NewSet(passwords ...string) Set {
+	s := Set{}
+	for _, p := range passwords {
+		s[sha1Hex(p)] = struct{}{}
+	}
+	return s
+}
+
+func (s Set) Contains(password string) (bool, error) {
+	_, ok := s[sha1Hex(password)]
+	return ok, nil
+}
+
+//go:embed common.txt
+var commonPasswords string
+
+// Common holds the most used passwords. It is always checked, so the worst
+// passwords are caught even without a breach corpus on disk.
+var Common = NewSet(strings.Fields(commonPasswords)...)
+
+// Checker validates passwords against a Policy and breach corpora.
+type Checker struct {
+	Policy   Policy
+	Breached []Corpus
+}
+
+func NewChecker(policy Policy, breached ...Corpus) *Checker {
+	return &Checker{Policy: policy, Breached: append([]Corpus{Common}, breached...)}
+}
+
+// Validate returns a *ValidationError if password must not be used by the
+// account with email. Other errors come from reading a corpus.
+func (c *Checker) Validate(password, email string) error {
+	violations := c.Policy.Check(password, email)
+	for _, corpus := range c.Breached {
+		breached, err := corpus.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Code:    CodeBreached,
+				Message: "Password appeared in a data breach and is used by attackers, choose a different one",
+			})
+			break
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
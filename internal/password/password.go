@@ -0,0 +1,170 @@
+// Package password decides whether a password is good enough to be set. It
+// checks a configurable Policy and looks the password up in corpora of
+// passwords known from breaches.
+package password
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation codes reported in a ValidationError.
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeTooWeak       = "too_weak"
+	CodeContainsEmail = "contains_email"
+	CodeBreached      = "breached"
+)
+
+// Violation is one requirement a password failed.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every requirement a password failed, so users can
+// fix them all at once.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Policy are the requirements every password has to meet. Lengths count
+// characters, not bytes.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinEntropy is the estimated strength in bits, see Entropy.
+	MinEntropy float64
+	// DisallowEmail rejects passwords containing the account's email or the
+	// name part of it.
+	DisallowEmail bool
+}
+
+// DefaultPolicy follows the usual recommendation of a length requirement
+// instead of composition rules.
+var DefaultPolicy = Policy{
+	MinLength:     8,
+	MaxLength:     128,
+	MinEntropy:    36,
+	DisallowEmail: true,
+}
+
+// Check returns the violations of password for the account with email.
+func (p Policy) Check(password, email string) []Violation {
+	violations := []Violation{}
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+	}
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, Violation{
+			Code:    CodeContainsEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+	// A short password is already reported, its strength says nothing new.
+	if length >= p.MinLength {
+		if bits := Entropy(password); bits < p.MinEntropy {
+			violations = append(violations, Violation{
+				Code: CodeTooWeak,
+				Message: fmt.Sprintf("Password is too easy to guess (estimated %.0f bits, %.0f required), "+
+					"use a longer password or more kinds of characters", bits, p.MinEntropy),
+			})
+		}
+	}
+	return violations
+}
+
+// containsEmail reports whether password contains email or a name part of it
+// long enough to matter.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	name, _, _ := strings.Cut(email, "@")
+	return len(name) >= 4 && strings.Contains(password, name)
+}
+
+// Entropy estimates the strength of password in bits. Every character adds
+// the bits of the pool of character classes used; characters repeating the
+// previous one or continuing a sequence like "abc" or "321" add just one.
+func Entropy(password string) float64 {
+	pool := 0
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	perChar := math.Log2(float64(pool))
+	bits := 0.0
+	var prev, step rune
+	for i, r := range password {
+		diff := r - prev
+		switch {
+		case i == 0:
+			bits += perChar
+		case diff == 0 || (diff == step && (diff == 1 || diff == -1)):
+			bits++
+		default:
+			bits += perChar
+		}
+		step = diff
+		prev = r
+	}
+	return bits
+}
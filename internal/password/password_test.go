@@ -0,0 +1,90 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func codes(violations []Violation) map[string]bool {
+	got := map[string]bool{}
+	for _, v := range violations {
+		got[v.Code] = true
+	}
+	return got
+}
+
+func TestPolicyCheck(t *testing.T) {
+	cases := []struct {
+		password string
+		email    string
+		want     []string
+	}{
+		{"", "walt@breakingbad.com", []string{CodeTooShort}},
+		{"short", "walt@breakingbad.com", []string{CodeTooShort}},
+		{"aaaaaaaaaaaa", "walt@breakingbad.com", []string{CodeTooWeak}},
+		{"abcdefghijkl", "walt@breakingbad.com", []string{CodeTooWeak}},
+		{"9876543210", "walt@breakingbad.com", []string{CodeTooWeak}},
+		{"Walt@BreakingBad.com", "walt@breakingbad.com", []string{CodeContainsEmail}},
+		{"heisenberg-says-hi", "heisenberg@breakingbad.com", []string{CodeContainsEmail}},
+		{"jesse-2008-abq", "walt@breakingbad.com", nil},
+		{"correct horse battery staple", "walt@breakingbad.com", nil},
+		{"schöne grüße", "walt@breakingbad.com", nil},
+	}
+	for _, c := range cases {
+		got := codes(DefaultPolicy.Check(c.password, c.email))
+		if len(got) != len(c.want) {
+			t.Errorf("%q: expected violations %v, got %v", c.password, c.want, got)
+			continue
+		}
+		for _, code := range c.want {
+			if !got[code] {
+				t.Errorf("%q: expected violations %v, got %v", c.password, c.want, got)
+			}
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if Entropy("") != 0 {
+		t.Errorf("Expected empty password to have no entropy")
+	}
+	if Entropy("abcdefgh") >= Entropy("hcegbfad") {
+		t.Errorf("Expected a sequence to be weaker than the same letters shuffled")
+	}
+	if Entropy("password") >= Entropy("Pa55w0rd!") {
+		t.Errorf("Expected more character classes to be stronger")
+	}
+}
+
+func TestRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1 of "hunter2" is F3BBBD66A63D4BF1747940578EC3D0103530E21D.
+	err := os.WriteFile(filepath.Join(dir, "F3BBB"), []byte("0000000000000000000000000000000000A:3\r\nD66A63D4BF1747940578EC3D0103530E21D:17043\r\n"), 0o644)
+	if err != nil {
+		t.Fatal("failed to write range file:", err)
+	}
+	corpus := RangeDir(dir)
+	if found, err := corpus.Contains("hunter2"); err != nil || !found {
+		t.Errorf("Expected hunter2 to be found, got %v (%v)", found, err)
+	}
+	if found, err := corpus.Contains("hunter3"); err != nil || found {
+		t.Errorf("Expected hunter3 not to be found, got %v (%v)", found, err)
+	}
+}
+
+func TestCheckerValidate(t *testing.T) {
+	checker := NewChecker(DefaultPolicy, NewSet("blue-meth-99"))
+	if err := checker.Validate("los pollos hermanos", "walt@breakingbad.com"); err != nil {
+		t.Errorf("Expected password to be accepted: %v", err)
+	}
+
+	for _, breached := range []string{"blue-meth-99", "password123"} {
+		err := checker.Validate(breached, "walt@breakingbad.com")
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || !codes(validationErr.Violations)[CodeBreached] {
+			t.Errorf("Expected %q to be reported as breached, got %v", breached, err)
+		}
+	}
+}
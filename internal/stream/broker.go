@@ -0,0 +1,195 @@
+package stream
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Event is a message fanned out to live subscribers. ID is assigned by the
+// broker as "<epoch>-<seq>", it is what clients send back as Last-Event-ID.
+// The epoch changes with every broker, so an ID from before a restart is
+// never mistaken for one of the new sequence. Events with a Recipient are
+// private to that user, Protected events are meant for the author's approved
+// followers only.
+type Event struct {
+	ID        string
+	seq       uint64
+	Key       string
+	Type      string
+	AuthorID  uuid.UUID
+	SubjectID uuid.UUID
+	Recipient uuid.UUID
+	Protected bool
+	Hashtags  []string
+	Data      json.RawMessage
+}
+
+// Filter decides whether a subscriber receives an event.
+type Filter func(Event) bool
+
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter Filter
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Done is closed when the broker dropped the subscription because it fell
+// too far behind, or when it was unsubscribed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// Broker is an in-process fan-out with a bounded replay buffer. Publish never
+// blocks: a subscriber whose queue is full is disconnected instead, so one
+// slow client cannot hold up posting.
+type Broker struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	replay      []Event
+	replaySize  int
+	queueSize   int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(replaySize, queueSize int) *Broker {
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		replaySize:  replaySize,
+		queueSize:   queueSize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish assigns the next ID to event and delivers it. Events whose Key was
+// already published within the replay window are dropped, which makes
+// redelivery from an at-least-once source harmless.
+func (b *Broker) Publish(event Event) (Event, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.Key != "" {
+		for _, seen := range b.replay {
+			if seen.Key == event.Key {
+				return seen, false
+			}
+		}
+	}
+
+	b.seq++
+	event.seq = b.seq
+	event.ID = b.epoch + "-" + strconv.FormatUint(b.seq, 10)
+	b.replay = append(b.replay, event)
+	if len(b.replay) > b.replaySize {
+		b.replay = b.replay[len(b.replay)-b.replaySize:]
+	}
+
+	for sub := range b.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			sub.close()
+		}
+	}
+	return event, true
+}
+
+// Subscribe registers a subscriber. If lastEventID is not empty the buffered
+// events after it are returned for replay; complete is false when the buffer
+// no longer reaches back that far, or when the ID was not issued by this
+// broker, and the client has to resync.
+func (b *Broker) Subscribe(filter Filter, lastEventID string) (sub *Subscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, b.queueSize)
+	sub = &Subscription{
+		C:      ch,
+		ch:     ch,
+		filter: filter,
+		done:   make(chan struct{}),
+	}
+	b.subscribers[sub] = struct{}{}
+
+	complete = true
+	if lastEventID == "" {
+		return sub, nil, complete
+	}
+	after, known := b.resumePoint(lastEventID)
+	if !known {
+		complete = false
+	}
+	if len(b.replay) > 0 && b.replay[0].seq > after+1 {
+		complete = false
+	}
+	if len(b.replay) == 0 && b.seq > after {
+		complete = false
+	}
+	for _, event := range b.replay {
+		if event.seq > after && (filter == nil || filter(event)) {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, complete
+}
+
+// resumePoint returns the sequence number of lastEventID. IDs of another
+// epoch, malformed ones and ones ahead of the sequence are not known, and
+// resume from the start of the buffer.
+func (b *Broker) resumePoint(lastEventID string) (uint64, bool) {
+	epoch, seqStr, found := strings.Cut(lastEventID, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > b.seq {
+		return 0, false
+	}
+	return seq, true
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+	sub.close()
+}
+
+// Hashtags returns the lower cased, de-duplicated hashtags of a chirp body.
+func Hashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := strings.TrimRightFunc(word[1:], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		tag = strings.ToLower(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
@@ -0,0 +1,116 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBrokerFilters(t *testing.T) {
+	broker := NewBroker(10, 10)
+	author := uuid.New()
+	sub, _, _ := broker.Subscribe(func(e Event) bool { return e.AuthorID == author }, "")
+
+	broker.Publish(Event{Type: "chirp.created", AuthorID: uuid.New()})
+	broker.Publish(Event{Type: "chirp.created", AuthorID: author})
+
+	select {
+	case event := <-sub.C:
+		if event.AuthorID != author || event.ID != broker.epoch+"-2" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event for the author")
+	}
+	select {
+	case event := <-sub.C:
+		t.Errorf("Expected no further events, got %+v", event)
+	default:
+	}
+}
+
+func TestBrokerReplay(t *testing.T) {
+	broker := NewBroker(3, 10)
+	for i := 0; i < 5; i++ {
+		broker.Publish(Event{Key: fmt.Sprint(i), Type: "chirp.created"})
+	}
+
+	t.Run("resume inside buffer", func(t *testing.T) {
+		_, replay, complete := broker.Subscribe(nil, broker.epoch+"-3")
+		if !complete || len(replay) != 2 || replay[0].seq != 4 || replay[1].seq != 5 {
+			t.Errorf("Unexpected replay: complete=%v events=%+v", complete, replay)
+		}
+	})
+
+	t.Run("resume behind buffer", func(t *testing.T) {
+		_, replay, complete := broker.Subscribe(nil, broker.epoch+"-1")
+		if complete {
+			t.Errorf("Expected incomplete replay, got %+v", replay)
+		}
+		if len(replay) != 3 {
+			t.Errorf("Expected the whole buffer to be replayed, got %d events", len(replay))
+		}
+	})
+
+	t.Run("resume from before a restart", func(t *testing.T) {
+		restarted := NewBroker(3, 10)
+		restarted.Publish(Event{Type: "chirp.created"})
+		_, replay, complete := restarted.Subscribe(nil, broker.epoch+"-5")
+		if complete || len(replay) != 1 {
+			t.Errorf("Expected a resync and the whole buffer, got complete=%v events=%+v", complete, replay)
+		}
+	})
+
+	t.Run("resume ahead of the sequence", func(t *testing.T) {
+		_, _, complete := broker.Subscribe(nil, broker.epoch+"-9")
+		if complete {
+			t.Errorf("Expected a resync for an ID that was never issued")
+		}
+	})
+
+	t.Run("resume from a malformed ID", func(t *testing.T) {
+		_, _, complete := broker.Subscribe(nil, "42")
+		if complete {
+			t.Errorf("Expected a resync for an ID without epoch")
+		}
+	})
+
+	t.Run("duplicate keys are dropped", func(t *testing.T) {
+		_, published := broker.Publish(Event{Key: "4", Type: "chirp.created"})
+		if published {
+			t.Errorf("Expected duplicate event to be dropped")
+		}
+	})
+}
+
+func TestBrokerDropsSlowSubscriber(t *testing.T) {
+	broker := NewBroker(10, 1)
+	slow, _, _ := broker.Subscribe(nil, "")
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			broker.Publish(Event{Type: "chirp.created"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Errorf("Expected slow subscriber to be disconnected")
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	got := Hashtags("Hello #Go and #go, also #chirpy! # alone")
+	if len(got) != 2 || got[0] != "go" || got[1] != "chirpy" {
+		t.Errorf("Unexpected hashtags: %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInsecureURL      = errors.New("url must be an absolute https URL")
+	ErrForbiddenAddress = errors.New("url must not point to a loopback, link-local, private or unspecified address")
+)
+
+// forbiddenIP reports whether ip is an address receivers must not live at,
+// so endpoints cannot be used to reach the server's own network.
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified()
+}
+
+// ValidateURL parses the URL of a new endpoint and resolves its host. Every
+// address the host resolves to must be public. Plain http is only accepted
+// with allowHTTP, for local development.
+func ValidateURL(ctx context.Context, raw string, allowHTTP bool) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, ErrInsecureURL
+	}
+	if parsed.Scheme != "https" && !(allowHTTP && parsed.Scheme == "http") {
+		return nil, ErrInsecureURL
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s: %w", parsed.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return nil, ErrForbiddenAddress
+		}
+	}
+	return parsed, nil
+}
+
+// dialControl refuses connections to forbidden addresses. It runs after
+// name resolution, so a host that is rebound to an internal address after
+// ValidateURL accepted it is still caught.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbiddenIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are posted with. It never uses a
+// proxy and checks every address it connects to, redirects included.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForbiddenIP(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"::1":             true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"::":              true,
+		"::ffff:10.0.0.1": true,
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+	}
+	for addr, want := range cases {
+		if got := forbiddenIP(net.ParseIP(addr)); got != want {
+			t.Errorf("forbiddenIP(%s) = %v, expected %v", addr, got, want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	ctx := context.Background()
+	_, err := ValidateURL(ctx, "http://93.184.216.34/hook", false)
+	if !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("Expected plain http to be rejected, got %v", err)
+	}
+	_, err = ValidateURL(ctx, "http://93.184.216.34/hook", true)
+	if err != nil {
+		t.Errorf("Expected plain http to be allowed in development, got %v", err)
+	}
+	_, err = ValidateURL(ctx, "/hook", false)
+	if !errors.Is(err, ErrInsecureURL) {
+		t.Errorf("Expected a relative URL to be rejected, got %v", err)
+	}
+	for _, raw := range []string{
+		"https://127.0.0.1/hook",
+		"https://[::1]/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://10.0.0.5:8443/hook",
+		"https://localhost/hook",
+	} {
+		_, err = ValidateURL(ctx, raw, true)
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Expected %s to be rejected, got %v", raw, err)
+		}
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	defer receiver.Close()
+
+	_, err := NewClient(time.Second).Get(receiver.URL)
+	if !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("Expected the dial to be refused, got %v", err)
+	}
+}
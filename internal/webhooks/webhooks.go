@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+const (
+	EventChirpCreated = events.ChirpCreated
+	EventChirpDeleted = events.ChirpDeleted
+	EventUserCreated  = events.UserCreated
+	EventUserUpgraded = events.UserUpgraded
+)
+
+// EventTypes lists every event an endpoint can subscribe to.
+var EventTypes = []string{
+	EventChirpCreated,
+	EventChirpDeleted,
+	EventUserCreated,
+	EventUserUpgraded,
+}
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+func ValidEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the envelope every receiver gets as the request body.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func MakeSecret() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
+
+// Sign returns the value of the Chirpy-Signature header for body. The
+// timestamp is part of the signed content so receivers can reject replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+// Verify checks a Chirpy-Signature header the way a receiver should.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed signature timestamp")
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)).Abs() > tolerance {
+		return fmt.Errorf("signature timestamp outside of tolerance")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery is one event queued for one endpoint.
+type Delivery struct {
+	ID         uuid.UUID
+	EndpointID uuid.UUID
+	URL        string
+	Secret     string
+	EventType  string
+	Payload    []byte
+	// Attempts is the number of attempts made before this one.
+	Attempts int
+}
+
+// Attempt records the outcome of a single POST to an endpoint.
+type Attempt struct {
+	DeliveryID  uuid.UUID
+	Number      int
+	AttemptedAt time.Time
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+}
+
+// Store is the persistence the Worker needs. The server backs it with
+// Postgres, tests with an in-memory implementation.
+type Store interface {
+	// ClaimDueDeliveries returns up to limit due deliveries and hides them
+	// from other workers until lockedUntil, after which a delivery that was
+	// not recorded is picked up again.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lockedUntil time.Time) ([]Delivery, error)
+	RecordAttempt(ctx context.Context, attempt Attempt) error
+	MarkDelivered(ctx context.Context, deliveryID uuid.UUID) error
+	ScheduleRetry(ctx context.Context, deliveryID uuid.UUID, next time.Time) error
+	MarkFailed(ctx context.Context, deliveryID uuid.UUID) error
+	// EndpointFailed bumps the consecutive failure counter of an endpoint
+	// and returns the new value.
+	EndpointFailed(ctx context.Context, endpointID uuid.UUID) (int, error)
+	EndpointSucceeded(ctx context.Context, endpointID uuid.UUID) error
+	DisableEndpoint(ctx context.Context, endpointID uuid.UUID) error
+}
+
+type Worker struct {
+	Store  Store
+	Client *http.Client
+	// MaxAttempts is the number of tries before a delivery is marked failed.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// DisableAfter consecutive failed attempts disable the endpoint.
+	DisableAfter int
+	BatchSize    int
+	// Lease is how long a claimed batch is hidden from other workers. It has
+	// to outlast posting the whole batch.
+	Lease time.Duration
+	Now   func() time.Time
+}
+
+func NewWorker(store Store) *Worker {
+	return &Worker{
+		Store:        store,
+		Client:       NewClient(10 * time.Second),
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		DisableAfter: 20,
+		BatchSize:    50,
+		Lease:        15 * time.Minute,
+		Now:          time.Now,
+	}
+}
+
+// Run processes due deliveries every interval until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := w.ProcessDue(ctx)
+		if err != nil {
+			log.Printf("webhooks: processing deliveries: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue claims and attempts every delivery that is due and returns how
+// many were attempted. Several workers may run against the same store.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	now := w.Now()
+	deliveries, err := w.Store.ClaimDueDeliveries(ctx, now, w.BatchSize, now.Add(w.Lease))
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range deliveries {
+		err = w.deliver(ctx, delivery)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Backoff returns the delay before the attempt following attempt number n.
+func (w *Worker) Backoff(n int) time.Duration {
+	delay := w.BaseBackoff
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= w.MaxBackoff {
+			return w.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func (w *Worker) deliver(ctx context.Context, delivery Delivery) error {
+	attempt := Attempt{
+		DeliveryID:  delivery.ID,
+		Number:      delivery.Attempts + 1,
+		AttemptedAt: w.Now(),
+	}
+	statusCode, err := w.post(ctx, delivery, attempt.AttemptedAt)
+	attempt.Duration = w.Now().Sub(attempt.AttemptedAt)
+	attempt.StatusCode = statusCode
+	if err == nil && (statusCode < 200 || statusCode > 299) {
+		err = fmt.Errorf("receiver responded with status %d", statusCode)
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	recordErr := w.Store.RecordAttempt(ctx, attempt)
+	if recordErr != nil {
+		return recordErr
+	}
+	if err == nil {
+		recordErr = w.Store.MarkDelivered(ctx, delivery.ID)
+		if recordErr != nil {
+			return recordErr
+		}
+		return w.Store.EndpointSucceeded(ctx, delivery.EndpointID)
+	}
+
+	if attempt.Number >= w.MaxAttempts {
+		recordErr = w.Store.MarkFailed(ctx, delivery.ID)
+	} else {
+		recordErr = w.Store.ScheduleRetry(ctx, delivery.ID, attempt.AttemptedAt.Add(w.Backoff(attempt.Number)))
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	failures, recordErr := w.Store.EndpointFailed(ctx, delivery.EndpointID)
+	if recordErr != nil {
+		return recordErr
+	}
+	if w.DisableAfter > 0 && failures >= w.DisableAfter {
+		log.Printf("webhooks: disabling endpoint %s after %d consecutive failures", delivery.EndpointID, failures)
+		return w.Store.DisableEndpoint(ctx, delivery.EndpointID)
+	}
+	return nil
+}
+
+func (w *Worker) post(ctx context.Context, delivery Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, now, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	return res.StatusCode, nil
+}
@@ -0,0 +1,273 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memDelivery struct {
+	Delivery
+	status string
+	next   time.Time
+}
+
+type memStore struct {
+	mu         sync.Mutex
+	deliveries map[uuid.UUID]*memDelivery
+	attempts   []Attempt
+	failures   map[uuid.UUID]int
+	disabled   map[uuid.UUID]bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		deliveries: map[uuid.UUID]*memDelivery{},
+		failures:   map[uuid.UUID]int{},
+		disabled:   map[uuid.UUID]bool{},
+	}
+}
+
+func (s *memStore) add(d Delivery, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[d.ID] = &memDelivery{Delivery: d, status: "pending", next: next}
+}
+
+func (s *memStore) ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lockedUntil time.Time) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []Delivery{}
+	for _, d := range s.deliveries {
+		if len(due) == limit {
+			break
+		}
+		if d.status == "pending" && !d.next.After(now) && !s.disabled[d.EndpointID] {
+			d.next = lockedUntil
+			due = append(due, d.Delivery)
+		}
+	}
+	return due, nil
+}
+
+func (s *memStore) RecordAttempt(ctx context.Context, attempt Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, attempt)
+	return nil
+}
+
+func (s *memStore) MarkDelivered(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[id].status = "delivered"
+	s.deliveries[id].Attempts++
+	return nil
+}
+
+func (s *memStore) ScheduleRetry(ctx context.Context, id uuid.UUID, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[id].next = next
+	s.deliveries[id].Attempts++
+	return nil
+}
+
+func (s *memStore) MarkFailed(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[id].status = "failed"
+	s.deliveries[id].Attempts++
+	return nil
+}
+
+func (s *memStore) EndpointFailed(ctx context.Context, id uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[id]++
+	return s.failures[id], nil
+}
+
+func (s *memStore) EndpointSucceeded(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[id] = 0
+	return nil
+}
+
+func (s *memStore) DisableEndpoint(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled[id] = true
+	return nil
+}
+
+func newTestDelivery(url string) Delivery {
+	return Delivery{
+		ID:         uuid.New(),
+		EndpointID: uuid.New(),
+		URL:        url,
+		Secret:     "whsec_test",
+		EventType:  EventChirpCreated,
+		Payload:    []byte(`{"type":"chirp.created"}`),
+	}
+}
+
+func TestWorkerDelivers(t *testing.T) {
+	var gotBody []byte
+	var gotSignature, gotEvent string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+		gotEvent = r.Header.Get(EventHeader)
+		w.WriteHeader(204)
+	}))
+	defer receiver.Close()
+
+	store := newMemStore()
+	delivery := newTestDelivery(receiver.URL)
+	store.add(delivery, time.Now())
+
+	worker := NewWorker(store)
+	worker.Client = receiver.Client()
+	n, err := worker.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatal("failed to process deliveries:", err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected 1 attempted delivery, got %d", n)
+	}
+	if store.deliveries[delivery.ID].status != "delivered" {
+		t.Errorf("Expected delivery to be delivered, got %s", store.deliveries[delivery.ID].status)
+	}
+	if gotEvent != EventChirpCreated {
+		t.Errorf("Unexpected event header: got %v, want %v", gotEvent, EventChirpCreated)
+	}
+	err = Verify(delivery.Secret, gotSignature, gotBody, time.Minute)
+	if err != nil {
+		t.Errorf("Receiver could not verify signature: %v", err)
+	}
+	err = Verify("whsec_other", gotSignature, gotBody, time.Minute)
+	if err == nil {
+		t.Errorf("Signature verified with the wrong secret")
+	}
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(500)
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	store := newMemStore()
+	delivery := newTestDelivery(receiver.URL)
+	store.add(delivery, now)
+
+	worker := NewWorker(store)
+	worker.Client = receiver.Client()
+	worker.MaxAttempts = 3
+	worker.DisableAfter = 0
+	worker.Now = func() time.Time { return now }
+
+	t.Run("schedules retry", func(t *testing.T) {
+		worker.ProcessDue(context.Background())
+		got := store.deliveries[delivery.ID]
+		if got.status != "pending" {
+			t.Fatalf("Expected delivery to stay pending, got %s", got.status)
+		}
+		if want := now.Add(worker.BaseBackoff); !got.next.Equal(want) {
+			t.Errorf("Unexpected next attempt: got %v, want %v", got.next, want)
+		}
+	})
+
+	t.Run("not due before backoff", func(t *testing.T) {
+		n, _ := worker.ProcessDue(context.Background())
+		if n != 0 {
+			t.Errorf("Expected no attempts before backoff elapsed, got %d", n)
+		}
+	})
+
+	t.Run("backoff doubles", func(t *testing.T) {
+		now = now.Add(worker.BaseBackoff)
+		worker.ProcessDue(context.Background())
+		got := store.deliveries[delivery.ID]
+		if want := now.Add(2 * worker.BaseBackoff); !got.next.Equal(want) {
+			t.Errorf("Unexpected next attempt: got %v, want %v", got.next, want)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		now = now.Add(2 * worker.BaseBackoff)
+		worker.ProcessDue(context.Background())
+		if got := store.deliveries[delivery.ID].status; got != "failed" {
+			t.Errorf("Expected delivery to be failed, got %s", got)
+		}
+		if calls != 3 || len(store.attempts) != 3 {
+			t.Errorf("Expected 3 recorded attempts, got %d calls and %d attempts", calls, len(store.attempts))
+		}
+		if store.attempts[0].StatusCode != 500 || store.attempts[0].Error == "" {
+			t.Errorf("Attempt was not recorded with status and error: %+v", store.attempts[0])
+		}
+	})
+}
+
+func TestWorkerDisablesEndpoint(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(410)
+	}))
+	defer receiver.Close()
+
+	store := newMemStore()
+	endpointID := uuid.New()
+	for i := 0; i < 3; i++ {
+		delivery := newTestDelivery(receiver.URL)
+		delivery.EndpointID = endpointID
+		store.add(delivery, time.Now())
+	}
+
+	worker := NewWorker(store)
+	worker.Client = receiver.Client()
+	worker.DisableAfter = 3
+	worker.ProcessDue(context.Background())
+
+	if !store.disabled[endpointID] {
+		t.Errorf("Expected endpoint to be disabled after %d failures", worker.DisableAfter)
+	}
+	n, _ := worker.ProcessDue(context.Background())
+	if n != 0 {
+		t.Errorf("Expected no deliveries for a disabled endpoint, got %d", n)
+	}
+}
+
+func TestWorkerClaimsDeliveries(t *testing.T) {
+	now := time.Now()
+	store := newMemStore()
+	delivery := newTestDelivery("https://example.com/hook")
+	store.add(delivery, now)
+
+	worker := NewWorker(store)
+	claimed, _ := store.ClaimDueDeliveries(context.Background(), now, worker.BatchSize, now.Add(worker.Lease))
+	if len(claimed) != 1 {
+		t.Fatalf("Expected to claim 1 delivery, got %d", len(claimed))
+	}
+
+	worker.Now = func() time.Time { return now }
+	n, _ := worker.ProcessDue(context.Background())
+	if n != 0 {
+		t.Errorf("Expected a claimed delivery to be skipped, got %d attempts", n)
+	}
+
+	claimed, _ = store.ClaimDueDeliveries(context.Background(), now.Add(worker.Lease), worker.BatchSize, now.Add(2*worker.Lease))
+	if len(claimed) != 1 {
+		t.Errorf("Expected an abandoned delivery to be claimed again after the lease, got %d", len(claimed))
+	}
+}
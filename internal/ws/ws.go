@@ -0,0 +1,306 @@
+// Package ws implements the server side of the WebSocket protocol (RFC 6455)
+// as far as Chirpy needs it: text and binary messages, fragmentation, and
+// ping, pong and close control frames. Extensions are not supported.
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close codes used by Chirpy, see RFC 6455 section 7.4.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseTryAgainLater   = 1013
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by ReadMessage when the peer sent a close frame.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", e.Code, e.Reason)
+}
+
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+	closed  bool
+
+	// MaxMessageSize limits the size of a reassembled message.
+	MaxMessageSize int64
+	// PongHandler is called from ReadMessage for every pong frame.
+	PongHandler func(data []byte)
+}
+
+// Accept computes the Sec-WebSocket-Accept value for a handshake key.
+func Accept(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade performs the opening handshake and takes over the connection.
+// On failure an HTTP error has already been written.
+func Upgrade(w http.ResponseWriter, req *http.Request) (*Conn, error) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "websocket handshake requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method not GET")
+	}
+	if !headerContains(req.Header, "Connection", "upgrade") || !headerContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing upgrade headers")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid key")
+	}
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket upgrade not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	// Drop any deadline the server set for the HTTP exchange.
+	netConn.SetDeadline(time.Time{})
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + Accept(key) + "\r\n\r\n"
+	_, err = rw.WriteString(handshake)
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &Conn{
+		conn:           netConn,
+		br:             rw.Reader,
+		MaxMessageSize: 64 << 10,
+	}, nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var header [2]byte
+	_, err := io.ReadFull(c.br, header[:])
+	if err != nil {
+		return frame{}, err
+	}
+	f := frame{
+		fin:    header[0]&0x80 != 0,
+		opcode: header[0] & 0x0F,
+	}
+	if header[0]&0x70 != 0 {
+		return frame{}, c.protocolError("reserved bits set")
+	}
+	masked := header[1]&0x80 != 0
+	if !masked {
+		return frame{}, c.protocolError("client frames must be masked")
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if f.opcode >= OpClose && (length > 125 || !f.fin) {
+		return frame{}, c.protocolError("invalid control frame")
+	}
+	if length > uint64(c.MaxMessageSize) {
+		c.WriteClose(CloseMessageTooBig, "message too big")
+		return frame{}, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return frame{}, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+func (c *Conn) protocolError(reason string) error {
+	c.WriteClose(CloseProtocolError, reason)
+	return &CloseError{Code: CloseProtocolError, Reason: reason}
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and a close frame is echoed before a *CloseError is returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch f.opcode {
+		case OpPing:
+			err = c.WriteMessage(OpPong, f.payload)
+			if err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.PongHandler != nil {
+				c.PongHandler(f.payload)
+			}
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: 1005}
+			if len(f.payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(f.payload[:2]))
+				closeErr.Reason = string(f.payload[2:])
+			}
+			c.WriteClose(CloseNormal, "")
+			return 0, nil, closeErr
+		case OpText, OpBinary:
+			if message != nil {
+				return 0, nil, c.protocolError("expected continuation frame")
+			}
+			opcode = int(f.opcode)
+			message = f.payload
+		case OpContinuation:
+			if message == nil {
+				return 0, nil, c.protocolError("unexpected continuation frame")
+			}
+			if int64(len(message)+len(f.payload)) > c.MaxMessageSize {
+				c.WriteClose(CloseMessageTooBig, "message too big")
+				return 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+			}
+			message = append(message, f.payload...)
+		default:
+			return 0, nil, c.protocolError("unknown opcode")
+		}
+		if f.fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// WriteMessage sends one unfragmented frame. It is safe for concurrent use.
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeFrame(opcode, data, time.Now().Add(10*time.Second))
+}
+
+func (c *Conn) writeFrame(opcode int, data []byte, deadline time.Time) error {
+	header := []byte{0x80 | byte(opcode)}
+	switch {
+	case len(data) <= 125:
+		header = append(header, byte(len(data)))
+	case len(data) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(data)))
+	}
+	c.conn.SetWriteDeadline(deadline)
+	_, err := c.conn.Write(append(header, data...))
+	return err
+}
+
+// WriteClose sends a close frame. No further messages can be written
+// afterwards; the peer is expected to answer and close the connection.
+func (c *Conn) WriteClose(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	c.closed = true
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	return c.writeFrame(OpClose, payload, time.Now().Add(time.Second))
+}
+
+// Close closes the underlying connection without a closing handshake.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,160 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, server *httptest.Server) *testClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("failed to dial:", err)
+	}
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	conn.Write([]byte(req))
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal("failed to read handshake:", err)
+	}
+	if res.StatusCode != 101 {
+		t.Fatalf("Expected 101 Switching Protocols, got %d", res.StatusCode)
+	}
+	if got := res.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept: %v", got)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testClient{conn: conn, br: br}
+}
+
+func (c *testClient) writeFrame(fin bool, opcode byte, payload []byte) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0x80 | byte(len(payload))}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.conn.Write(frame)
+}
+
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		t.Fatal("failed to read frame:", err)
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(c.br, payload)
+	return header[0] & 0x0F, payload
+}
+
+func echoServer(t *testing.T, serverErr chan<- error) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			opcode, message, err := conn.ReadMessage()
+			if err != nil {
+				serverErr <- err
+				return
+			}
+			conn.WriteMessage(opcode, message)
+		}
+	}))
+}
+
+func TestEcho(t *testing.T) {
+	serverErr := make(chan error, 1)
+	server := echoServer(t, serverErr)
+	defer server.Close()
+	client := dial(t, server)
+
+	t.Run("text message", func(t *testing.T) {
+		client.writeFrame(true, OpText, []byte("hello"))
+		opcode, payload := client.readFrame(t)
+		if opcode != OpText || string(payload) != "hello" {
+			t.Errorf("Unexpected echo: opcode %d payload %q", opcode, payload)
+		}
+	})
+
+	t.Run("fragmented message with interleaved ping", func(t *testing.T) {
+		client.writeFrame(false, OpText, []byte("hel"))
+		client.writeFrame(true, OpPing, []byte("p"))
+		client.writeFrame(true, OpContinuation, []byte("lo again"))
+
+		opcode, payload := client.readFrame(t)
+		if opcode != OpPong || string(payload) != "p" {
+			t.Errorf("Expected pong first, got opcode %d payload %q", opcode, payload)
+		}
+		opcode, payload = client.readFrame(t)
+		if opcode != OpText || string(payload) != "hello again" {
+			t.Errorf("Unexpected echo: opcode %d payload %q", opcode, payload)
+		}
+	})
+
+	t.Run("close handshake", func(t *testing.T) {
+		client.writeFrame(true, OpClose, []byte{0x03, 0xE8})
+		opcode, _ := client.readFrame(t)
+		if opcode != OpClose {
+			t.Errorf("Expected close frame, got opcode %d", opcode)
+		}
+		err := <-serverErr
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseNormal {
+			t.Errorf("Expected close error with code 1000, got %v", err)
+		}
+	})
+}
+
+func TestRejectsUnmaskedFrames(t *testing.T) {
+	serverErr := make(chan error, 1)
+	server := echoServer(t, serverErr)
+	defer server.Close()
+	client := dial(t, server)
+
+	client.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	opcode, payload := client.readFrame(t)
+	if opcode != OpClose || binary.BigEndian.Uint16(payload) != CloseProtocolError {
+		t.Errorf("Expected protocol error close, got opcode %d payload %v", opcode, payload)
+	}
+}
+
+func TestRejectsPlainHTTP(t *testing.T) {
+	server := echoServer(t, make(chan error, 1))
+	defer server.Close()
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal("failed to request:", err)
+	}
+	if res.StatusCode != 400 {
+		t.Errorf("Expected 400 for a plain request, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+)
+
+// loadJWTKeys builds the access token key set. JWT_SIGNING_KEY names a PEM
+// file with the Ed25519 or RSA private key tokens are signed with;
+// JWT_VERIFY_KEYS is a comma separated list of PEM files whose keys are
+// still accepted, e.g. the previous signing key during a rotation. Without
+// a signing key tokens are signed with SECRET_KEY using HS256.
+func loadJWTKeys(secretKey string) *auth.KeySet {
+	signingFile := os.Getenv("JWT_SIGNING_KEY")
+	if signingFile == "" {
+		return auth.NewHMACKeySet(secretKey)
+	}
+	verifyFiles := []string{}
+	for _, file := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			verifyFiles = append(verifyFiles, file)
+		}
+	}
+	keys, err := auth.LoadKeySet(signingFile, verifyFiles...)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	return keys
+}
+
+// jwksHandler publishes the public keys access tokens can be verified with.
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(200)
+	w.Write(cfg.jwtKeys.JWKS())
+}
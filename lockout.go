@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/lockout"
+	"github.com/Lunnaris01/bootdev_servers/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	securityEventLoginFailed   = "login.failed"
+	securityEventAccountLocked = "account.locked"
+	securityEventIPLocked      = "login.ip_locked"
+)
+
+// accountLockoutPolicy protects a single account against password guessing.
+var accountLockoutPolicy = lockout.Policy{
+	FreeAttempts: 5,
+	BaseDelay:    time.Second,
+	MaxDelay:     30 * time.Second,
+	LockAfter:    10,
+	LockDuration: 15 * time.Minute,
+	Window:       time.Hour,
+}
+
+// ipLockoutPolicy is looser since many users can share an address, but
+// stops one client from spraying passwords across many accounts.
+var ipLockoutPolicy = lockout.Policy{
+	FreeAttempts: 20,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	LockAfter:    100,
+	LockDuration: time.Hour,
+	Window:       time.Hour,
+}
+
+// resetAccountPolicy limits how many reset mails one address can be sent.
+// Every request counts, whether the account exists or not.
+var resetAccountPolicy = lockout.Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     15 * time.Minute,
+	LockAfter:    10,
+	LockDuration: time.Hour,
+	Window:       time.Hour,
+}
+
+// resetIPPolicy stops one client from mailing many addresses.
+var resetIPPolicy = lockout.Policy{
+	FreeAttempts: 10,
+	BaseDelay:    10 * time.Second,
+	MaxDelay:     5 * time.Minute,
+	LockAfter:    50,
+	LockDuration: time.Hour,
+	Window:       time.Hour,
+}
+
+// loginGuards count failed logins per account and per client IP, and
+// password reset requests the same way.
+type loginGuards struct {
+	account      *lockout.Guard
+	ip           *lockout.Guard
+	resetAccount *lockout.Guard
+	resetIP      *lockout.Guard
+}
+
+func newLoginGuards(store lockout.Store) *loginGuards {
+	return &loginGuards{
+		account:      lockout.NewGuard(store, "account:", accountLockoutPolicy),
+		ip:           lockout.NewGuard(store, "ip:", ipLockoutPolicy),
+		resetAccount: lockout.NewGuard(store, "reset-account:", resetAccountPolicy),
+		resetIP:      lockout.NewGuard(store, "reset-ip:", resetIPPolicy),
+	}
+}
+
+// newLockoutStoreFromEnv keeps the counters in Postgres so all instances
+// share them. LOCKOUT_STORE=memory keeps them in the process instead.
+func newLockoutStoreFromEnv(db *database.Queries) lockout.Store {
+	if os.Getenv("LOCKOUT_STORE") == "memory" {
+		return lockout.NewMemoryStore()
+	}
+	return lockoutStore{db: db}
+}
+
+// accountKey normalizes email so differently cased attempts count together.
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginWait returns how long the client of req has to wait before it may try
+// to log in to email again. Counter errors are logged and let the attempt
+// through rather than locking everyone out.
+func (cfg *apiConfig) loginWait(req *http.Request, email string) time.Duration {
+	accountWait, err := cfg.loginGuards.account.Wait(req.Context(), accountKey(email))
+	if err != nil {
+		log.Printf("lockout: reading account counter: %v", err)
+	}
+	ipWait, err := cfg.loginGuards.ip.Wait(req.Context(), clientIP(req))
+	if err != nil {
+		log.Printf("lockout: reading IP counter: %v", err)
+	}
+	return max(accountWait, ipWait)
+}
+
+// writeTooManyAttempts rejects a login attempt made before wait is over.
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(429)
+	w.Write([]byte("Too many failed login attempts, try again later"))
+}
+
+// loginFailed counts a failed login to email from req. userID is uuid.Nil
+// when no such account exists.
+func (cfg *apiConfig) loginFailed(req *http.Request, email string, userID uuid.UUID, reason string) {
+	ctx := req.Context()
+	ip := clientIP(req)
+	target := ""
+	if userID != uuid.Nil {
+		target = userID.String()
+	}
+	cfg.recordAuditBestEffort(ctx, auditEntry{
+		Action:     auditLoginFailed,
+		TargetType: auditTargetUser,
+		TargetID:   target,
+		Diff:       map[string]any{"email": email, "reason": reason},
+	})
+	if userID != uuid.Nil {
+		err := recordSecurityEvent(ctx, cfg.dbQueries, securityEventLoginFailed, userID, map[string]any{
+			"ip":     ip,
+			"reason": reason,
+		})
+		if err != nil {
+			log.Printf("lockout: recording failed login: %v", err)
+		}
+	}
+
+	locked, err := cfg.loginGuards.account.Fail(ctx, accountKey(email))
+	if err != nil {
+		log.Printf("lockout: counting account failure: %v", err)
+	}
+	if locked && userID != uuid.Nil {
+		err = recordSecurityEvent(ctx, cfg.dbQueries, securityEventAccountLocked, userID, map[string]any{
+			"ip":           ip,
+			"locked_until": time.Now().Add(accountLockoutPolicy.LockDuration),
+		})
+		if err != nil {
+			log.Printf("lockout: recording account lock: %v", err)
+		}
+		// Sent in the background so the response time does not differ
+		// between locked and unlocked attempts.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			err := cfg.sendLockoutEmail(ctx, email, ip)
+			if err != nil {
+				log.Printf("lockout: notifying user %s: %v", userID, err)
+			}
+		}()
+	}
+
+	locked, err = cfg.loginGuards.ip.Fail(ctx, ip)
+	if err != nil {
+		log.Printf("lockout: counting IP failure: %v", err)
+	}
+	if locked {
+		err = recordSecurityEvent(ctx, cfg.dbQueries, securityEventIPLocked, uuid.Nil, map[string]any{
+			"ip":           ip,
+			"locked_until": time.Now().Add(ipLockoutPolicy.LockDuration),
+		})
+		if err != nil {
+			log.Printf("lockout: recording IP lock: %v", err)
+		}
+	}
+}
+
+// loginSucceeded forgets the failures of the account. The IP counter is
+// left alone so one valid account does not unlock guessing at others.
+func (cfg *apiConfig) loginSucceeded(req *http.Request, email string) {
+	err := cfg.loginGuards.account.Succeed(req.Context(), accountKey(email))
+	if err != nil {
+		log.Printf("lockout: resetting account counter: %v", err)
+	}
+}
+
+func (cfg *apiConfig) sendLockoutEmail(ctx context.Context, email, ip string) error {
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your Chirpy account was locked",
+		Body: fmt.Sprintf("There were too many failed attempts to log in to your Chirpy account, the last one from %s.\n\n"+
+			"Logging in is blocked for the next %v. If this was not you, consider changing your password; "+
+			"resetting it through POST /api/password/forgot works while the account is locked.\n",
+			ip, accountLockoutPolicy.LockDuration),
+	})
+}
+
+// runLockoutCleanup periodically deletes counters that no longer affect
+// logins.
+func (cfg *apiConfig) runLockoutCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			window := max(accountLockoutPolicy.Window, ipLockoutPolicy.Window, resetAccountPolicy.Window, resetIPPolicy.Window)
+			_, err := cfg.dbQueries.DeleteStaleLoginFailures(ctx, time.Now().Add(-window))
+			if err != nil {
+				log.Printf("lockout: deleting stale counters: %v", err)
+			}
+		}
+	}
+}
+
+// lockoutStore keeps failure counters in Postgres.
+type lockoutStore struct {
+	db *database.Queries
+}
+
+func newCounter(row database.LoginFailure) lockout.Counter {
+	return lockout.Counter{
+		Failures:    int(row.Failures),
+		LastFailure: row.LastFailureAt,
+		LockedUntil: row.LockedUntil.Time,
+	}
+}
+
+func (s lockoutStore) Get(ctx context.Context, key string) (lockout.Counter, error) {
+	row, err := s.db.GetLoginFailures(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lockout.Counter{}, nil
+	}
+	if err != nil {
+		return lockout.Counter{}, err
+	}
+	return newCounter(row), nil
+}
+
+func (s lockoutStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (lockout.Counter, error) {
+	row, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		Now:         now,
+		WindowStart: now.Add(-window),
+	})
+	if err != nil {
+		return lockout.Counter{}, err
+	}
+	return newCounter(row), nil
+}
+
+func (s lockoutStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.LockLoginFailures(ctx, database.LockLoginFailuresParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+}
+
+func (s lockoutStore) Reset(ctx context.Context, key string) error {
+	return s.db.ResetLoginFailures(ctx, key)
+}
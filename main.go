@@ -7,23 +7,51 @@ import (
 	"encoding/json"
 	"io"
 	"strings"
+	"strconv"
 	_ "github.com/lib/pq"
 	"github.com/joho/godotenv"
 	"github.com/Lunnaris01/bootdev_servers/internal/database"
 	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/webhooks"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/Lunnaris01/bootdev_servers/internal/mailer"
+	"github.com/Lunnaris01/bootdev_servers/internal/password"
 	"os"
 	"database/sql"
 	"log"
 	"time"
 	"github.com/google/uuid"
 	"sort"
+	"errors"
+	"context"
+	"os/signal"
+	"syscall"
 )
 
+// refreshTokenTTL is how long a refresh token stays valid. Rotating issues a
+// fresh token with a fresh lifetime.
+const refreshTokenTTL = 60*24*time.Hour
+
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db *sql.DB
 	dbQueries *database.Queries
+	outbox *events.Relay
+	broker *stream.Broker
+	wsHub *wsHub
+	shuttingDown chan struct{}
+	mailer mailer.Mailer
+	requireEmailVerification bool
 	platform string
 	secretKey string
+	jwtKeys *auth.KeySet
+	oidcProviders map[string]*oidcProvider
+	loginGuards *loginGuards
+	passwordResetSlots chan struct{}
+	passwordChecker *password.Checker
+	passwordHasher *auth.PasswordHasher
+	adminEmails map[string]bool
 	polkaKey string
 
 }
@@ -35,6 +63,16 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateUser returns the ID of the user owning the request's bearer
+// access token.
+func (cfg *apiConfig) authenticateUser(req *http.Request) (uuid.UUID, error) {
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return claims.UserID, nil
+}
+
 func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, req *http.Request){
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(200)
@@ -61,6 +99,16 @@ func (cfg *apiConfig) resetHandler(w http.ResponseWriter, req *http.Request){
 	cfg.dbQueries.DeleteAllUsers(req.Context())
 	cfg.dbQueries.DeleteAllChirps(req.Context())
 	cfg.dbQueries.DeleteAllRefreshTokens(req.Context())
+	cfg.dbQueries.DeleteAllWebhookEvents(req.Context())
+	cfg.dbQueries.DeleteAllOutboxEvents(req.Context())
+	cfg.dbQueries.DeleteAllSecurityEvents(req.Context())
+	cfg.dbQueries.DeleteAllLoginFailures(req.Context())
+	claims, _ := cfg.authenticate(req)
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action: auditReset,
+		ActorID: claims.UserID,
+		TargetType: auditTargetServer,
+	})
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(200)
 	w.Write([]byte("Reset successfull"))
@@ -72,6 +120,7 @@ func (cfg *apiConfig) postChirpsHandler (w http.ResponseWriter, req *http.Reques
 	type req_body struct {
 		Body string `json:"body"`
 		UserID uuid.UUID `json:"user_id"`
+		ReplyToID *uuid.UUID `json:"reply_to_id"`
 	}
 
 	type res_body struct{
@@ -80,19 +129,19 @@ func (cfg *apiConfig) postChirpsHandler (w http.ResponseWriter, req *http.Reques
 		UpdatedAt time.Time `json:"updated_at"`
 		Body string `json:"body"`
 		UserID uuid.UUID `json:"user_id"`
+		ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
 	}
 
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	
+	claims, err := cfg.authenticate(req)
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte(err.Error()))
 		return
 	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secretKey)
+	userID := claims.UserID
+	err = cfg.requireVerifiedEmail(req.Context(), userID)
 	if err != nil {
-		w.WriteHeader(401)
+		w.WriteHeader(403)
 		w.Write([]byte(err.Error()))
 		return
 	}
@@ -117,7 +166,28 @@ func (cfg *apiConfig) postChirpsHandler (w http.ResponseWriter, req *http.Reques
 		w.Write([]byte("Chirp too Long!"))
 		return
 	}
-	dbChirp, err := cfg.dbQueries.CreateChirp(req.Context(),database.CreateChirpParams{r_body.Body,userID})
+	// Only chirps the author can see can be replied to.
+	var replyToID uuid.NullUUID
+	if r_body.ReplyToID != nil {
+		parent, err := cfg.dbQueries.GetVisibleChirp(req.Context(),database.GetVisibleChirpParams{
+			ID: *r_body.ReplyToID,
+			ViewerID: userID,
+		})
+		if err != nil {
+			w.WriteHeader(404)
+			w.Write([]byte("Chirp not found"))
+			return
+		}
+		replyToID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+	var dbChirp database.Chirp
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		dbChirp, err = q.CreateChirp(req.Context(),database.CreateChirpParams{Body: r_body.Body, UserID: userID, ReplyToID: replyToID})
+		if err != nil {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.ChirpCreated, dbChirp.ID, newChirpEventPayload(dbChirp))
+	})
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte(err.Error()))
@@ -130,6 +200,7 @@ func (cfg *apiConfig) postChirpsHandler (w http.ResponseWriter, req *http.Reques
 		UpdatedAt: dbChirp.UpdatedAt,
 		Body: dbChirp.Body,
 		UserID: userID,
+		ReplyToID: r_body.ReplyToID,
 	}
 
 	response_json, _ := json.Marshal(retChirp)
@@ -159,8 +230,9 @@ func (cfg *apiConfig) getChirpsHandler (w http.ResponseWriter, req *http.Request
 	
 	var chirps []database.Chirp
 	var err error
+	viewerID := cfg.viewerID(req)
 	if authorID == ""{
-		chirps, err = cfg.dbQueries.GetAllChirps(req.Context())
+		chirps, err = cfg.dbQueries.GetAllChirps(req.Context(), viewerID)
 	} else {
 		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
@@ -168,7 +240,10 @@ func (cfg *apiConfig) getChirpsHandler (w http.ResponseWriter, req *http.Request
 			w.Write([]byte(err.Error()))
 			return
 		}
-		chirps, err = cfg.dbQueries.GetAllChirpsForAuthor(req.Context(),authorUUID)
+		chirps, err = cfg.dbQueries.GetAllChirpsForAuthor(req.Context(),database.GetAllChirpsForAuthorParams{
+			UserID: authorUUID,
+			ViewerID: viewerID,
+		})
 	}
 
 	if err != nil {
@@ -187,6 +262,7 @@ func (cfg *apiConfig) getChirpsHandler (w http.ResponseWriter, req *http.Request
 		UpdatedAt time.Time `json:"updated_at"`
 		Body string `json:"body"`
 		UserID uuid.UUID `json:"user_id"`
+		ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
 	}
 	var res_chirps []resChirp
 
@@ -198,6 +274,9 @@ func (cfg *apiConfig) getChirpsHandler (w http.ResponseWriter, req *http.Request
 			Body: chirp.Body,
 			UserID: chirp.UserID,
 		})
+		if chirp.ReplyToID.Valid {
+			res_chirps[len(res_chirps)-1].ReplyToID = &chirp.ReplyToID.UUID
+		}
 
 	}
 	
@@ -219,7 +298,10 @@ func (cfg *apiConfig) getChirpHandler (w http.ResponseWriter, req *http.Request)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	db_chirp, err := cfg.dbQueries.GetChirp(req.Context(),chirpIDUUID)
+	db_chirp, err := cfg.dbQueries.GetVisibleChirp(req.Context(),database.GetVisibleChirpParams{
+		ID: chirpIDUUID,
+		ViewerID: cfg.viewerID(req),
+	})
 	if err != nil {
 		w.WriteHeader(404)
 		w.Write([]byte(err.Error()))
@@ -232,6 +314,7 @@ func (cfg *apiConfig) getChirpHandler (w http.ResponseWriter, req *http.Request)
 		UpdatedAt time.Time `json:"updated_at"`
 		Body string `json:"body"`
 		UserID uuid.UUID `json:"user_id"`
+		ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
 	}
 	res_chirp := resChirp{
 		ID: db_chirp.ID,
@@ -240,6 +323,9 @@ func (cfg *apiConfig) getChirpHandler (w http.ResponseWriter, req *http.Request)
 		Body: db_chirp.Body,
 		UserID: db_chirp.UserID,
 	}
+	if db_chirp.ReplyToID.Valid {
+		res_chirp.ReplyToID = &db_chirp.ReplyToID.UUID
+	}
 	response_json, err := json.Marshal(res_chirp)
 	if err != nil {
 		w.WriteHeader(400)
@@ -259,33 +345,46 @@ func (cfg *apiConfig) deleteChirpHandler (w http.ResponseWriter, req *http.Reque
 		w.Write([]byte(err.Error()))
 		return
 	}
-	db_chirp, err := cfg.dbQueries.GetChirp(req.Context(),chirpIDUUID)
+	// Chirps the user cannot see are not found rather than forbidden.
+	db_chirp, err := cfg.dbQueries.GetVisibleChirp(req.Context(),database.GetVisibleChirpParams{
+		ID: chirpIDUUID,
+		ViewerID: cfg.viewerID(req),
+	})
 	if err != nil {
 		w.WriteHeader(404)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte(err.Error()))
-		return
-	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.secretKey)
+	claims, err := cfg.authenticate(req)
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte(err.Error()))
 		return
 	}
+	userID := claims.UserID
 	if db_chirp.UserID != userID{
 		w.WriteHeader(403)
 		return
 	}
 	
-	err = cfg.dbQueries.DeleteChirp(req.Context(),chirpIDUUID)
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		err := q.DeleteChirp(req.Context(),chirpIDUUID)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(req.Context(), q, auditEntry{
+			Action: auditChirpDeleted,
+			ActorID: userID,
+			TargetType: auditTargetChirp,
+			TargetID: db_chirp.ID.String(),
+			Diff: auditChirpRemoval(db_chirp),
+		})
+		if err != nil {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.ChirpDeleted, db_chirp.ID, newChirpEventPayload(db_chirp))
+	})
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte(err.Error()))
@@ -307,6 +406,7 @@ func (cfg *apiConfig) addUserHandler(w http.ResponseWriter, req *http.Request){
 		UpdatedAt time.Time `json:"updated_at"`
 		Email     string	`json:"email"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
+		EmailVerified bool `json:"email_verified"`
 	}
 
 	r_body := addUserBody{}
@@ -324,30 +424,56 @@ func (cfg *apiConfig) addUserHandler(w http.ResponseWriter, req *http.Request){
 		w.Write([]byte(err.Error()))
 		return
 	}
-	hashedPassword, err := auth.HashPassword(r_body.Password)
+	if !validEmail(r_body.Email) {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid email address"))
+		return
+	}
+	err = cfg.passwordChecker.Validate(r_body.Password, r_body.Email)
+	if err != nil {
+		writePasswordError(w, err)
+		return
+	}
+	hashedPassword, err := cfg.passwordHasher.Hash(r_body.Password)
 	if err != nil {
 		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	db_user, err := cfg.dbQueries.CreateUser(
-		req.Context(),
-		database.CreateUserParams{
-			Email: r_body.Email,
-			HashedPassword: hashedPassword,
+	var db_user database.User
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		db_user, err = q.CreateUser(
+			req.Context(),
+			database.CreateUserParams{
+				Email: r_body.Email,
+				HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+			})
+		if err != nil {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.UserCreated, db_user.ID, map[string]any{
+			"id": db_user.ID,
+			"created_at": db_user.CreatedAt,
 		})
+	})
 	if err != nil {
 		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
 		return
 	}
+	err = cfg.sendVerificationEmail(req.Context(), db_user)
+	if err != nil {
+		log.Printf("email verification: sending to user %s: %v", db_user.ID, err)
+	}
+	cfg.bootstrapAdmin(req.Context(), db_user)
 	ret_user := User {
 		ID: db_user.ID,
 		CreatedAt: db_user.CreatedAt,
 		UpdatedAt: db_user.UpdatedAt,
 		Email: db_user.Email,
 		IsChirpyRed: db_user.IsChirpyRed,
+		EmailVerified: db_user.EmailVerifiedAt.Valid,
 	}
 	response_json, _ := json.Marshal(ret_user)
 	w.WriteHeader(201)
@@ -360,17 +486,6 @@ func (cfg *apiConfig) loginUserHandler (w http.ResponseWriter, req *http.Request
 		Password string `json:"password"`
 	}
 
-	type User struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Email     string	`json:"email"`
-		Token 	  string	`json:"token"`
-		RefreshToken string `json:"refresh_token"`
-		IsChirpyRed bool `json:"is_chirpy_red"`
-	}
-
-
 	r_body := loginUserBody{}
 	r_data, err := io.ReadAll(req.Body)
 	defer req.Body.Close()
@@ -386,40 +501,82 @@ func (cfg *apiConfig) loginUserHandler (w http.ResponseWriter, req *http.Request
 		w.Write([]byte(err.Error()))
 		return
 	}
+	wait := cfg.loginWait(req, r_body.Email)
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
 	db_user, err := cfg.dbQueries.GetUserByMail(req.Context(),r_body.Email)
 	if err != nil {
+		cfg.loginFailed(req, r_body.Email, uuid.Nil, "unknown_account")
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
-	err = auth.CheckPasswordHash(r_body.Password,db_user.HashedPassword)
+	err = cfg.verifyPassword(req.Context(), db_user, r_body.Password)
 	if err != nil {
+		cfg.loginFailed(req, r_body.Email, db_user.ID, "password")
 		w.WriteHeader(401)
 		w.Write([]byte("Incorrect email or password"))
 		return
 	}
 
-	jwtToken, err := auth.MakeJWT(db_user.ID,cfg.secretKey,time.Duration(1)*time.Hour)
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Failed to create JWT Token"))
+	if userSuspended(db_user) {
+		writeAccountSuspended(w, db_user)
 		return
 	}
 
-	str_refreshToken, err := auth.MakeRefreshToken()
+	// The counter is only reset once the second factor was checked too.
+	if db_user.TotpEnabledAt.Valid {
+		cfg.startMFAChallenge(w, db_user)
+		return
+	}
+	cfg.loginSucceeded(req, db_user.Email)
+	cfg.completeLogin(w, req, db_user)
+}
+
+// completeLogin issues an access and a refresh token for an authenticated
+// user and writes the login response.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, req *http.Request, db_user database.User){
+	type User struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Email     string	`json:"email"`
+		Token 	  string	`json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		IsChirpyRed bool `json:"is_chirpy_red"`
+	}
 
-	refreshTokenParams := database.CreateRefreshTokenParams{
-		Token:		str_refreshToken,
-		ExpiresAt:	time.Now().Add(time.Duration(60*24)*time.Hour),
-		UserID:		db_user.ID,
+	// Also covers the logins that did not start with a password.
+	if userSuspended(db_user) {
+		writeAccountSuspended(w, db_user)
+		return
 	}
 
-	refreshToken, err := cfg.dbQueries.CreateRefreshToken(req.Context(),refreshTokenParams)
+	sessionID := uuid.New()
+	jwtToken, err := cfg.jwtKeys.Sign(auth.NewClaims(db_user.ID,sessionID,auth.ScopesForRole(db_user.Role),time.Duration(1)*time.Hour))
 	if err != nil {
-		fmt.Println("Error creating refresh token: %v", err)
-		return 
+		w.WriteHeader(401)
+		w.Write([]byte("Failed to create JWT Token"))
+		return
 	}
 
+	str_refreshToken, _, err := createRefreshToken(req, cfg.dbQueries, db_user.ID, sessionID)
+	if err != nil {
+		log.Printf("login: creating refresh token for user %s: %v", db_user.ID, err)
+		w.WriteHeader(500)
+		w.Write([]byte("Failed to create refresh token"))
+		return
+	}
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action: auditLogin,
+		ActorID: db_user.ID,
+		TargetType: auditTargetUser,
+		TargetID: db_user.ID.String(),
+		Diff: map[string]any{"session_id": sessionID},
+	})
+
 
 
 	ret_user := User {
@@ -428,7 +585,7 @@ func (cfg *apiConfig) loginUserHandler (w http.ResponseWriter, req *http.Request
 		UpdatedAt: db_user.UpdatedAt,
 		Email: db_user.Email,
 		Token: jwtToken,
-		RefreshToken: refreshToken.Token,
+		RefreshToken: str_refreshToken,
 		IsChirpyRed: db_user.IsChirpyRed,
 	}
 	
@@ -440,6 +597,29 @@ func (cfg *apiConfig) loginUserHandler (w http.ResponseWriter, req *http.Request
 
 }
 
+// createRefreshToken generates a refresh token in familyID, the session, and
+// records the client of req on it. Only its hash is stored, the returned
+// string is the only copy of the token.
+func createRefreshToken(req *http.Request, q *database.Queries, userID, familyID uuid.UUID) (string, database.RefreshToken, error) {
+	str_refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", database.RefreshToken{}, err
+	}
+	refreshToken, err := q.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		TokenHash:	auth.HashRefreshToken(str_refreshToken),
+		TokenPrefix:	auth.RefreshTokenPrefix(str_refreshToken),
+		ExpiresAt:	time.Now().Add(refreshTokenTTL),
+		UserID:		userID,
+		FamilyID:	familyID,
+		UserAgent:	req.UserAgent(),
+		IpAddress:	clientIP(req),
+	})
+	return str_refreshToken, refreshToken, err
+}
+
+// refreshAccessToken exchanges a refresh token for a new access token and a
+// new refresh token. Each refresh token works once; presenting a rotated one
+// again means it leaked, so the whole family is revoked.
 func (cfg *apiConfig) refreshAccessToken (w http.ResponseWriter, req *http.Request){
 	bearerToken, err := auth.GetBearerToken(req.Header)
 	if err != nil {
@@ -447,14 +627,65 @@ func (cfg *apiConfig) refreshAccessToken (w http.ResponseWriter, req *http.Reque
 		w.Write([]byte("Failed to retreive Refresh Token"))
 		return
 	}
-	tokenUserID, err := cfg.dbQueries.GetUserFromRefreshToken(req.Context(),bearerToken)
+
+	var newRefreshToken database.RefreshToken
+	var str_newRefreshToken string
+	var db_user database.User
+	reused := false
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		refreshToken, err := q.GetRefreshTokenForUpdate(req.Context(), auth.HashRefreshToken(bearerToken))
+		if err != nil {
+			return err
+		}
+		if refreshToken.RotatedAt.Valid {
+			reused = true
+			err = q.RevokeRefreshTokenFamily(req.Context(), refreshToken.FamilyID)
+			if err != nil {
+				return err
+			}
+			return recordSecurityEvent(req.Context(), q, securityEventRefreshTokenReuse, refreshToken.UserID, map[string]any{
+				"family_id": refreshToken.FamilyID,
+				"rotated_at": refreshToken.RotatedAt.Time,
+				"remote_addr": req.RemoteAddr,
+				"user_agent": req.UserAgent(),
+			})
+		}
+		if refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now()) {
+			return sql.ErrNoRows
+		}
+		// The role may have changed since the login, and the user may have
+		// been suspended.
+		db_user, err = q.GetUserByID(req.Context(), refreshToken.UserID)
+		if err != nil {
+			return err
+		}
+		if userSuspended(db_user) {
+			return errAccountSuspended
+		}
+
+		err = q.MarkRefreshTokenRotated(req.Context(), refreshToken.ID)
+		if err != nil {
+			return err
+		}
+		str_newRefreshToken, newRefreshToken, err = createRefreshToken(req, q, refreshToken.UserID, refreshToken.FamilyID)
+		return err
+	})
+	if errors.Is(err, errAccountSuspended) {
+		writeAccountSuspended(w, db_user)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte("Invalid token"))
 		return
 	}
+	if reused {
+		w.WriteHeader(401)
+		w.Write([]byte("Refresh token was already used, all sessions of this login were revoked"))
+		return
+	}
 
-	jwtToken, err := auth.MakeJWT(tokenUserID,cfg.secretKey,time.Duration(1)*time.Hour)
+	jwtToken, err := cfg.jwtKeys.Sign(auth.NewClaims(newRefreshToken.UserID,newRefreshToken.FamilyID,auth.ScopesForRole(db_user.Role),time.Duration(1)*time.Hour))
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte("Failed to create access token"))
@@ -462,10 +693,12 @@ func (cfg *apiConfig) refreshAccessToken (w http.ResponseWriter, req *http.Reque
 	}
 	type ResponseBody struct {
 		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	res_body := ResponseBody{
 		Token:  jwtToken,
+		RefreshToken: str_newRefreshToken,
 	}
 	response_json, _ := json.Marshal(res_body)
 	w.WriteHeader(200)
@@ -480,33 +713,40 @@ func (cfg *apiConfig) revokeRefreshToken (w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	err = cfg.dbQueries.RevokeTokenAccess(req.Context(),database.RevokeTokenAccessParams{bearerToken,time.Now()})
+	revoked, err := cfg.dbQueries.RevokeTokenAccess(req.Context(), auth.HashRefreshToken(bearerToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Unknown or already revoked, either way it no longer works.
+		w.WriteHeader(204)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte("Failed to revoke Access for Token"))
 		return
 	}
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action: auditRefreshTokenRevoked,
+		ActorID: revoked.UserID,
+		TargetType: auditTargetSession,
+		TargetID: revoked.FamilyID.String(),
+	})
 	w.WriteHeader(204)
 
 }
 
 
 func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Request){
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		w.WriteHeader(401)
-		w.Write([]byte("Failed to retreive Refresh Token"))
-		return
-	}
-	tokenUserID, err := auth.ValidateJWT(bearerToken,cfg.secretKey)
+	claims, err := cfg.authenticate(req)
 	if err != nil {
 		w.WriteHeader(401)
 		w.Write([]byte("Invalid token"))
 		return
 	}
+	tokenUserID := claims.UserID
 	type updateUserBody struct{
 		Password string `json:"password"`
 		Email string `json:"email"`
+		RevokeOtherSessions bool `json:"revoke_other_sessions"`
 	}
 
 	r_body := updateUserBody{}
@@ -526,8 +766,18 @@ func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Reques
 		w.Write([]byte(err.Error()))
 		return
 	}
+	if !validEmail(r_body.Email) {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid email address"))
+		return
+	}
 
-	new_hashedPassword, err := auth.HashPassword(r_body.Password)
+	err = cfg.passwordChecker.Validate(r_body.Password, r_body.Email)
+	if err != nil {
+		writePasswordError(w, err)
+		return
+	}
+	new_hashedPassword, err := cfg.passwordHasher.Hash(r_body.Password)
 
 	if err != nil {
 		w.WriteHeader(401)
@@ -536,10 +786,39 @@ func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Reques
 	}
 
 
-	updated_user, err := cfg.dbQueries.UpdateUserPassAndMailByID(req.Context(),database.UpdateUserPassAndMailByIDParams{
-		ID: tokenUserID,
-		Email: r_body.Email,
-		HashedPassword: new_hashedPassword,
+	var updated_user database.User
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		old_user, err := q.GetUserByID(req.Context(), tokenUserID)
+		if err != nil {
+			return err
+		}
+		updated_user, err = q.UpdateUserPassAndMailByID(req.Context(),database.UpdateUserPassAndMailByIDParams{
+			ID: tokenUserID,
+			Email: r_body.Email,
+			HashedPassword: sql.NullString{String: new_hashedPassword, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if old_user.Email != updated_user.Email {
+			err = recordAudit(req.Context(), q, auditEntry{
+				Action: auditEmailChanged,
+				ActorID: tokenUserID,
+				TargetType: auditTargetUser,
+				TargetID: tokenUserID.String(),
+				Diff: map[string]any{"email": auditChange(old_user.Email, updated_user.Email)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return recordAudit(req.Context(), q, auditEntry{
+			Action: auditPasswordChanged,
+			ActorID: tokenUserID,
+			TargetType: auditTargetUser,
+			TargetID: tokenUserID.String(),
+			Diff: map[string]any{"password": map[string]any{"changed": true}},
+		})
 	})
 
 	if err != nil{
@@ -547,12 +826,30 @@ func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Reques
 		w.Write([]byte(err.Error()))
 		return
 	}
+	if r_body.RevokeOtherSessions {
+		revoked, err := cfg.dbQueries.RevokeOtherSessions(req.Context(), database.RevokeOtherSessionsParams{
+			UserID: tokenUserID,
+			FamilyID: claims.SessionID,
+		})
+		if err != nil {
+			log.Printf("Failed to revoke other sessions of user %s: %v", tokenUserID, err)
+		} else {
+			cfg.recordAuditBestEffort(req.Context(), auditOtherSessionsRevoked(tokenUserID, claims.SessionID, revoked))
+		}
+	}
+	if !updated_user.EmailVerifiedAt.Valid {
+		err = cfg.sendVerificationEmail(req.Context(), updated_user)
+		if err != nil {
+			log.Printf("email verification: sending to user %s: %v", updated_user.ID, err)
+		}
+	}
 
 	type User struct {
 		ID        uuid.UUID `json:"id"`
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email     string	`json:"email"`
+		EmailVerified bool `json:"email_verified"`
 	}
 
 	ret_user := User {
@@ -560,6 +857,7 @@ func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Reques
 		CreatedAt: updated_user.CreatedAt,
 		UpdatedAt: updated_user.UpdatedAt,
 		Email: updated_user.Email,
+		EmailVerified: updated_user.EmailVerifiedAt.Valid,
 	}
 	response_json, _ := json.Marshal(ret_user)
 	w.WriteHeader(200)
@@ -569,14 +867,11 @@ func (cfg *apiConfig) updateUserHandler (w http.ResponseWriter, req *http.Reques
 
 func (cfg *apiConfig) subscribeUser (w http.ResponseWriter, req *http.Request){
 	type subscribeUserBody struct{
+		ID string `json:"id"`
 		Event string `json:"event"`
-		Data struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
 	}
 
 	api_key, err := auth.GetAPIKey(req.Header)
-	fmt.Println(api_key)
 	if err != nil{
 		w.WriteHeader(401)
 		w.Write([]byte(err.Error()))
@@ -605,29 +900,53 @@ func (cfg *apiConfig) subscribeUser (w http.ResponseWriter, req *http.Request){
 		w.Write([]byte(err.Error()))
 		return
 	}
-	if r_body.Event != "user.upgraded"{
-		w.WriteHeader(204)
-		return
+
+	// Polka retries deliveries, so every event is logged before processing and
+	// a retry of an already handled event is acknowledged without side effects.
+	eventID := r_body.ID
+	if eventID == "" {
+		eventID = webhookEventID(r_data)
+	}
+	event, err := cfg.dbQueries.CreateWebhookEvent(req.Context(),database.CreateWebhookEventParams{
+		ID: eventID,
+		EventType: r_body.Event,
+		Payload: r_data,
+		LockedUntil: time.Now().Add(webhookEventLease),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Seen before: retry it if it failed or its processing was abandoned.
+		event, err = cfg.dbQueries.ClaimWebhookEvent(req.Context(),database.ClaimWebhookEventParams{
+			ID: eventID,
+			LockedUntil: time.Now().Add(webhookEventLease),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			existing, err := cfg.dbQueries.GetWebhookEvent(req.Context(),eventID)
+			if err == nil && existing.Status == webhookStatusPending {
+				// Another request is still on it; ask Polka to come back
+				// in case that one never finishes.
+				w.Header().Set("Retry-After", strconv.Itoa(int(webhookEventLease.Seconds())))
+				w.WriteHeader(503)
+				return
+			}
+			w.WriteHeader(204)
+			return
+		}
 	}
-	userUUID, err := uuid.Parse(r_body.Data.UserID)
 	if err != nil {
-		w.WriteHeader(404)
+		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	err = cfg.dbQueries.SubscribeUser(req.Context(),userUUID)
+	err = cfg.processWebhookEvent(req.Context(),event)
 	if err != nil {
 		w.WriteHeader(404)
 		w.Write([]byte(err.Error()))
 		return
 	}
 	w.WriteHeader(204)
-
-
-
-
 }
+
 func main(){
 	godotenv.Load()
 
@@ -643,35 +962,153 @@ func main(){
 
 	serveMux := http.NewServeMux()
 	server := http.Server{
-		Handler: serveMux,
+		Handler: middlewareRequestID(serveMux),
 		Addr: "localhost:8080",
 	}
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
+		db: db,
 		dbQueries: dbQueries,
 		platform: env_platform,
 		secretKey: env_secretKey,
+		jwtKeys: loadJWTKeys(env_secretKey),
+		oidcProviders: loadOIDCProviders(),
+		loginGuards: newLoginGuards(newLockoutStoreFromEnv(dbQueries)),
+		passwordResetSlots: make(chan struct{}, passwordResetWorkers),
+		passwordChecker: loadPasswordChecker(),
+		passwordHasher: loadPasswordHasher(),
+		adminEmails: loadAdminEmails(),
 		polkaKey: env_polkaKey,
+		broker: stream.NewBroker(1000, 64),
+		wsHub: newWSHub(),
+		shuttingDown: make(chan struct{}),
+		mailer: newMailerFromEnv(env_platform),
+		requireEmailVerification: os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true",
 	}
 
 	serveMux.Handle("/app/",http.StripPrefix("/app/",apiCfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
 	serveMux.HandleFunc("GET /api/healthz",healthHandler)
-	serveMux.HandleFunc("GET /admin/metrics",apiCfg.metricsHandler)
-	serveMux.HandleFunc("POST /admin/reset",apiCfg.resetHandler)
-	serveMux.HandleFunc("POST /api/chirps",apiCfg.postChirpsHandler)
+	serveMux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwksHandler)
+	oauthServer := apiCfg.newOAuthServer()
+	serveMux.HandleFunc("GET /.well-known/openid-configuration", oauthServer.DiscoveryHandler)
+	serveMux.HandleFunc("GET /oauth/authorize", oauthServer.AuthorizeHandler)
+	serveMux.HandleFunc("POST /oauth/authorize", oauthServer.AuthorizeHandler)
+	serveMux.HandleFunc("POST /oauth/token", oauthServer.TokenHandler)
+	serveMux.HandleFunc("POST /oauth/revoke", oauthServer.RevokeHandler)
+	serveMux.HandleFunc("GET /oauth/userinfo", oauthServer.UserInfoHandler)
+	serveMux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRequireRole(apiCfg.metricsHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("POST /admin/reset", apiCfg.middlewareRequireRole(apiCfg.resetHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(apiCfg.setUserRoleHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("GET /admin/role-changes", apiCfg.middlewareRequireRole(apiCfg.listRoleChangesHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("GET /admin/audit-log", apiCfg.middlewareRequireRole(apiCfg.listAuditLogHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("PUT /admin/users/{userID}/suspension", apiCfg.middlewareRequireRole(apiCfg.suspendUserHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("DELETE /admin/users/{userID}/suspension", apiCfg.middlewareRequireRole(apiCfg.unsuspendUserHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("PUT /admin/users/{userID}/shadow-ban", apiCfg.middlewareRequireRole(apiCfg.shadowBanUserHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("DELETE /admin/users/{userID}/shadow-ban", apiCfg.middlewareRequireRole(apiCfg.liftShadowBanHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("DELETE /admin/chirps/{chirpID}", apiCfg.middlewareRequireRole(apiCfg.moderateChirpHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("POST /api/chirps", apiCfg.middlewareRequireScopes(apiCfg.postChirpsHandler, auth.ScopeChirpsWrite))
 	serveMux.HandleFunc("GET /api/chirps", apiCfg.getChirpsHandler)
 	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirpHandler)
-	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}",apiCfg.deleteChirpHandler)
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.middlewareRequireScopes(apiCfg.deleteChirpHandler, auth.ScopeChirpsDelete))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/like", apiCfg.middlewareRequireScopes(apiCfg.likeChirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/like", apiCfg.middlewareRequireScopes(apiCfg.unlikeChirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", apiCfg.middlewareRequireScopes(apiCfg.rechirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.middlewareRequireScopes(apiCfg.undoRechirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("GET /api/stream", apiCfg.streamHandler)
+	serveMux.HandleFunc("GET /api/ws", apiCfg.websocketHandler)
 	serveMux.HandleFunc("POST /api/users",apiCfg.addUserHandler)
-	serveMux.HandleFunc("PUT /api/users", apiCfg.updateUserHandler)
+	serveMux.HandleFunc("PUT /api/users", apiCfg.middlewareRequireScopes(apiCfg.updateUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/verify", apiCfg.verifyEmailHandler)
+	serveMux.HandleFunc("POST /api/users/verify/resend", apiCfg.middlewareRequireScopes(apiCfg.resendVerificationHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/{userID}/follow", apiCfg.middlewareRequireScopes(apiCfg.followUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.middlewareRequireScopes(apiCfg.unfollowUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/{userID}/block", apiCfg.middlewareRequireScopes(apiCfg.blockUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.middlewareRequireScopes(apiCfg.unblockUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.middlewareRequireScopes(apiCfg.muteUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.middlewareRequireScopes(apiCfg.unmuteUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/users/blocks", apiCfg.middlewareRequireScopes(apiCfg.listBlocksHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("PUT /api/users/privacy", apiCfg.middlewareRequireScopes(apiCfg.updatePrivacyHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("PUT /api/users/handle", apiCfg.middlewareRequireScopes(apiCfg.updateHandleHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/users/follow-requests", apiCfg.middlewareRequireScopes(apiCfg.listFollowRequestsHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("POST /api/users/follow-requests/{userID}/approve", apiCfg.middlewareRequireScopes(apiCfg.approveFollowRequestHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/follow-requests/{userID}/deny", apiCfg.middlewareRequireScopes(apiCfg.denyFollowRequestHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/users/mutes", apiCfg.middlewareRequireScopes(apiCfg.listMutesHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("GET /api/notifications", apiCfg.middlewareRequireScopes(apiCfg.getNotificationsHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("POST /api/notifications/read", apiCfg.middlewareRequireScopes(apiCfg.readNotificationsHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/notifications/preferences", apiCfg.middlewareRequireScopes(apiCfg.getNotificationPreferencesHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("PUT /api/notifications/preferences", apiCfg.middlewareRequireScopes(apiCfg.updateNotificationPreferencesHandler, auth.ScopeUsersWrite))
 	serveMux.HandleFunc("POST /api/login",apiCfg.loginUserHandler)
+	serveMux.HandleFunc("POST /api/login/mfa", apiCfg.loginMFAHandler)
+	serveMux.HandleFunc("GET /api/login/oidc/{provider}", apiCfg.oidcLoginHandler)
+	serveMux.HandleFunc("GET /api/login/oidc/{provider}/callback", apiCfg.oidcCallbackHandler)
+	serveMux.HandleFunc("GET /api/users/identities", apiCfg.middlewareRequireScopes(apiCfg.listIdentitiesHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("POST /api/users/identities/{provider}", apiCfg.middlewareRequireScopes(apiCfg.linkIdentityHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("DELETE /api/users/identities/{provider}", apiCfg.middlewareRequireScopes(apiCfg.unlinkIdentityHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/totp", apiCfg.middlewareRequireScopes(apiCfg.enrollTOTPHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/totp/confirm", apiCfg.middlewareRequireScopes(apiCfg.confirmTOTPHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/password/forgot", apiCfg.forgotPasswordHandler)
+	serveMux.HandleFunc("POST /api/password/reset", apiCfg.resetPasswordHandler)
 	serveMux.HandleFunc("POST /api/refresh", apiCfg.refreshAccessToken)
+	serveMux.HandleFunc("POST /api/tokens", apiCfg.mintTokenHandler)
+	serveMux.HandleFunc("POST /api/keys", apiCfg.middlewareRequireScopes(apiCfg.createAPIKeyHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/keys", apiCfg.middlewareRequireScopes(apiCfg.listAPIKeysHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("DELETE /api/keys/{keyID}", apiCfg.middlewareRequireScopes(apiCfg.revokeAPIKeyHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/oauth/clients", apiCfg.middlewareRequireScopes(apiCfg.createOAuthClientHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/oauth/clients", apiCfg.middlewareRequireScopes(apiCfg.listOAuthClientsHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("DELETE /api/oauth/clients/{clientID}", apiCfg.middlewareRequireScopes(apiCfg.deleteOAuthClientHandler, auth.ScopeUsersWrite))
 	serveMux.HandleFunc("POST /api/revoke", apiCfg.revokeRefreshToken)
+	serveMux.HandleFunc("GET /api/sessions", apiCfg.middlewareRequireScopes(apiCfg.listSessionsHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("DELETE /api/sessions/{sessionID}", apiCfg.middlewareRequireScopes(apiCfg.revokeSessionHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/sessions/revoke-all", apiCfg.middlewareRequireScopes(apiCfg.revokeOtherSessionsHandler, auth.ScopeUsersWrite))
 	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.subscribeUser)
-
-	server.ListenAndServe()
-
-
+	serveMux.HandleFunc("POST /api/webhooks", apiCfg.middlewareRequireScopes(apiCfg.createWebhookEndpointHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/webhooks", apiCfg.middlewareRequireScopes(apiCfg.listWebhookEndpointsHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("DELETE /api/webhooks/{webhookID}", apiCfg.middlewareRequireScopes(apiCfg.deleteWebhookEndpointHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/webhooks/{webhookID}/enable", apiCfg.middlewareRequireScopes(apiCfg.enableWebhookEndpointHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries", apiCfg.middlewareRequireScopes(apiCfg.listWebhookDeliveriesHandler, auth.ScopeUsersRead))
+	serveMux.HandleFunc("GET /admin/webhooks/events", apiCfg.middlewareRequireRole(apiCfg.listWebhookEventsHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("POST /admin/webhooks/events/{eventID}/replay", apiCfg.middlewareRequireRole(apiCfg.replayWebhookEventHandler, auth.RoleAdmin))
+
+	apiCfg.outbox = events.NewRelay(
+		outboxStore{queries: dbQueries},
+		map[string]events.Sink{
+			"webhooks": events.SinkFunc(apiCfg.enqueueWebhook),
+			"notifications": events.SinkFunc(apiCfg.notificationSink),
+			"stream": events.SinkFunc(apiCfg.streamSink),
+		},
+	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go apiCfg.outbox.Run(ctx)
+	go webhooks.NewWorker(webhookStore{db: dbQueries}).Run(ctx, 5*time.Second)
+	go apiCfg.runLockoutCleanup(ctx, 10*time.Minute)
+	apiCfg.bootstrapAdmins(ctx)
+
+	// Shutdown does not wait for hijacked WebSocket connections and would
+	// wait forever for open event streams, so both are told to go away.
+	server.RegisterOnShutdown(func() {
+		close(apiCfg.shuttingDown)
+	})
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	drained := make(chan struct{})
+	go func() {
+		apiCfg.wsHub.Drain(shutdownCtx)
+		close(drained)
+	}()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+	<-drained
 }
 
 
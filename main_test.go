@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/mailer"
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// newTestConfig returns an apiConfig backed by a schema of its own in the
+// database at TEST_DB_URL, with every migration of sql/schema applied. The
+// schema is dropped when the test ends. Tests are skipped without
+// TEST_DB_URL.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal("failed to open database:", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal("failed to create schema:", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	parsed, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal("failed to parse TEST_DB_URL:", err)
+	}
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+	db, err := sql.Open("postgres", parsed.String())
+	if err != nil {
+		t.Fatal("failed to open database:", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrate(t, db)
+
+	return &apiConfig{
+		db:                 db,
+		dbQueries:          database.New(db),
+		mailer:             &mailer.MemoryMailer{},
+		platform:           "dev",
+		jwtKeys:            auth.NewHMACKeySet("test-secret"),
+		passwordResetSlots: make(chan struct{}, passwordResetWorkers),
+		adminEmails:        map[string]bool{},
+		broker:             stream.NewBroker(1000, 64),
+	}
+}
+
+// migrate runs the Up part of every goose migration in order.
+func migrate(t *testing.T, db *sql.DB) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("sql", "schema", "*.sql"))
+	if err != nil {
+		t.Fatal("failed to list migrations:", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal("failed to read migration:", err)
+		}
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		_, err = db.Exec(up)
+		if err != nil {
+			t.Fatalf("failed to apply %s: %v", file, err)
+		}
+	}
+}
+
+// newTestMux registers the routes the handler tests exercise the same way
+// main does.
+func newTestMux(cfg *apiConfig) *http.ServeMux {
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("GET /admin/audit-log", cfg.middlewareRequireRole(cfg.listAuditLogHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("PUT /admin/users/{userID}/role", cfg.middlewareRequireRole(cfg.setUserRoleHandler, auth.RoleAdmin))
+	serveMux.HandleFunc("PUT /admin/users/{userID}/shadow-ban", cfg.middlewareRequireRole(cfg.shadowBanUserHandler, auth.RoleModerator, auth.RoleAdmin))
+	serveMux.HandleFunc("POST /api/chirps", cfg.middlewareRequireScopes(cfg.postChirpsHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("GET /api/chirps", cfg.getChirpsHandler)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirpHandler)
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.middlewareRequireScopes(cfg.likeChirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.middlewareRequireScopes(cfg.rechirpHandler, auth.ScopeChirpsWrite))
+	serveMux.HandleFunc("POST /api/users/{userID}/follow", cfg.middlewareRequireScopes(cfg.followUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/{userID}/block", cfg.middlewareRequireScopes(cfg.blockUserHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("PUT /api/users/privacy", cfg.middlewareRequireScopes(cfg.updatePrivacyHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("PUT /api/users/handle", cfg.middlewareRequireScopes(cfg.updateHandleHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/webhooks", cfg.middlewareRequireScopes(cfg.createWebhookEndpointHandler, auth.ScopeUsersWrite))
+	serveMux.HandleFunc("POST /api/users/follow-requests/{userID}/approve", cfg.middlewareRequireScopes(cfg.approveFollowRequestHandler, auth.ScopeUsersWrite))
+	return serveMux
+}
+
+type testUser struct {
+	database.User
+	token string
+}
+
+// createTestUser creates a user with role and an access token carrying the
+// scopes a login would grant that role.
+func createTestUser(t *testing.T, cfg *apiConfig, role string) testUser {
+	t.Helper()
+	ctx := context.Background()
+	db_user, err := cfg.dbQueries.CreateUser(ctx, database.CreateUserParams{
+		Email: uuid.NewString() + "@example.com",
+	})
+	if err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+	if role != auth.RoleUser {
+		err = cfg.dbQueries.SetUserRole(ctx, database.SetUserRoleParams{ID: db_user.ID, Role: role})
+		if err != nil {
+			t.Fatal("failed to set role:", err)
+		}
+		db_user.Role = role
+	}
+	return testUser{User: db_user, token: signTestToken(t, cfg, db_user.ID, auth.ScopesForRole(role))}
+}
+
+func signTestToken(t *testing.T, cfg *apiConfig, userID uuid.UUID, scopes []string) string {
+	t.Helper()
+	token, err := cfg.jwtKeys.Sign(auth.NewClaims(userID, uuid.Nil, scopes, time.Hour))
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+	return token
+}
+
+func createTestChirp(t *testing.T, cfg *apiConfig, author testUser) database.Chirp {
+	t.Helper()
+	db_chirp, err := cfg.dbQueries.CreateChirp(context.Background(), database.CreateChirpParams{
+		Body:   "hello from " + author.Email,
+		UserID: author.ID,
+	})
+	if err != nil {
+		t.Fatal("failed to create chirp:", err)
+	}
+	return db_chirp
+}
+
+// serve sends a request to handler, with token as bearer token unless it
+// is empty.
+func serve(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/lib/pq"
+)
+
+// Handles are what chirps mention with @handle. They are stored lowercased.
+var (
+	handlePattern  = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w{3,30})\b`)
+)
+
+// maxMentions caps how many users a single chirp can notify.
+const maxMentions = 10
+
+// mentionedHandles returns the distinct lowercased handles body mentions.
+func mentionedHandles(body string) []string {
+	handles := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+func (cfg *apiConfig) updateHandleHandler(w http.ResponseWriter, req *http.Request) {
+	type handleBody struct {
+		Handle string `json:"handle"`
+	}
+
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	r_body := handleBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	handle := strings.ToLower(strings.TrimPrefix(r_body.Handle, "@"))
+	if !handlePattern.MatchString(handle) {
+		w.WriteHeader(400)
+		w.Write([]byte("Handles are 3 to 30 letters, digits or underscores"))
+		return
+	}
+
+	db_user, err := cfg.dbQueries.SetUserHandle(req.Context(), database.SetUserHandleParams{
+		ID:     userID,
+		Handle: sql.NullString{String: handle, Valid: true},
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		w.WriteHeader(409)
+		w.Write([]byte("Handle is taken"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Could not save handle"))
+		return
+	}
+	response_json, _ := json.Marshal(handleBody{Handle: db_user.Handle.String})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+)
+
+var (
+	errCodeAlreadyUsed     = errors.New("Code was already used")
+	errInvalidRecoveryCode = errors.New("Invalid recovery code")
+	errTOTPAlreadyEnabled  = errors.New("Two-factor authentication is already enabled")
+)
+
+// mfaChallengeKey signs MFA challenge tokens. It differs from the access
+// token key so a challenge can never be used as an access token.
+func (cfg *apiConfig) mfaChallengeKey() string {
+	return auth.HashToken("mfa-challenge", cfg.secretKey)
+}
+
+// startMFAChallenge answers the password step of a login for users with
+// TOTP enabled. The challenge token proves the password was correct.
+func (cfg *apiConfig) startMFAChallenge(w http.ResponseWriter, db_user database.User) {
+	type challengeResponse struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	mfaToken, err := auth.MakeJWT(db_user.ID, cfg.mfaChallengeKey(), mfaChallengeTTL)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte("Failed to create MFA challenge"))
+		return
+	}
+	response_json, _ := json.Marshal(challengeResponse{MFARequired: true, MFAToken: mfaToken})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) loginMFAHandler(w http.ResponseWriter, req *http.Request) {
+	type mfaBody struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	r_body := mfaBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	challenge, err := auth.ValidateJWT(r_body.MFAToken, cfg.mfaChallengeKey())
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid or expired MFA token"))
+		return
+	}
+	db_user, err := cfg.dbQueries.GetUserByID(req.Context(), challenge.UserID)
+	if err != nil || !db_user.TotpEnabledAt.Valid {
+		w.WriteHeader(401)
+		w.Write([]byte("Invalid or expired MFA token"))
+		return
+	}
+
+	wait := cfg.loginWait(req, db_user.Email)
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	switch {
+	case r_body.Code != "":
+		err = cfg.useTOTPCode(req, db_user, r_body.Code)
+	case r_body.RecoveryCode != "":
+		err = cfg.useRecoveryCode(req, db_user, r_body.RecoveryCode)
+	default:
+		w.WriteHeader(400)
+		w.Write([]byte("code or recovery_code is required"))
+		return
+	}
+	if err != nil {
+		cfg.loginFailed(req, db_user.Email, db_user.ID, "mfa_code")
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cfg.loginSucceeded(req, db_user.Email)
+	cfg.completeLogin(w, req, db_user)
+}
+
+// useTOTPCode accepts code for db_user at most once. The time step is stored
+// so neither the same code nor an older one works again.
+func (cfg *apiConfig) useTOTPCode(req *http.Request, db_user database.User, code string) error {
+	step, err := auth.ValidateTOTP(db_user.TotpSecret.String, code, time.Now())
+	if err != nil {
+		return err
+	}
+	updated, err := cfg.dbQueries.UseTOTPStep(req.Context(), database.UseTOTPStepParams{
+		ID:           db_user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errCodeAlreadyUsed
+	}
+	return nil
+}
+
+func (cfg *apiConfig) useRecoveryCode(req *http.Request, db_user database.User, code string) error {
+	used, err := cfg.dbQueries.UseRecoveryCode(req.Context(), database.UseRecoveryCodeParams{
+		UserID:   db_user.ID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code), cfg.secretKey),
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errInvalidRecoveryCode
+	}
+	return nil
+}
+
+func (cfg *apiConfig) enrollTOTPHandler(w http.ResponseWriter, req *http.Request) {
+	type enrollResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	db_user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	// Enrolling again before confirming replaces the pending secret.
+	updated, err := cfg.dbQueries.SetUserTOTPSecret(req.Context(), database.SetUserTOTPSecretParams{
+		ID:         userID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if updated == 0 {
+		w.WriteHeader(409)
+		w.Write([]byte("Two-factor authentication is already enabled"))
+		return
+	}
+
+	response_json, _ := json.Marshal(enrollResponse{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, db_user.Email, secret),
+	})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) confirmTOTPHandler(w http.ResponseWriter, req *http.Request) {
+	type confirmBody struct {
+		Code string `json:"code"`
+	}
+	type confirmResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	r_body := confirmBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	db_user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if db_user.TotpEnabledAt.Valid {
+		w.WriteHeader(409)
+		w.Write([]byte("Two-factor authentication is already enabled"))
+		return
+	}
+	if !db_user.TotpSecret.Valid {
+		w.WriteHeader(400)
+		w.Write([]byte("Start enrollment with POST /api/users/totp first"))
+		return
+	}
+	err = cfg.useTOTPCode(req, db_user, r_body.Code)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		enabled, err := q.EnableUserTOTP(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if enabled == 0 {
+			return errTOTPAlreadyEnabled
+		}
+		err = q.DeleteRecoveryCodes(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			err = q.CreateRecoveryCode(req.Context(), database.CreateRecoveryCodeParams{
+				CodeHash: auth.HashToken(code, cfg.secretKey),
+				UserID:   userID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errTOTPAlreadyEnabled) {
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// The plain codes are only shown this once.
+	response_json, _ := json.Marshal(confirmResponse{RecoveryCodes: codes})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errAccountSuspended = errors.New("This account is suspended")
+	errStaffModeration  = errors.New("Only admins can moderate moderators and admins")
+)
+
+// userSuspended reports whether db_user is suspended right now.
+func userSuspended(db_user database.User) bool {
+	if !db_user.SuspendedAt.Valid {
+		return false
+	}
+	return !db_user.SuspendedUntil.Valid || db_user.SuspendedUntil.Time.After(time.Now())
+}
+
+// userHidden reports whether the chirps of db_user are hidden from everyone
+// but db_user, see GetAllChirps.
+func userHidden(db_user database.User) bool {
+	return userSuspended(db_user) || db_user.ShadowBannedAt.Valid
+}
+
+// checkNotSuspended returns errAccountSuspended when userID is suspended.
+func (cfg *apiConfig) checkNotSuspended(ctx context.Context, userID uuid.UUID) error {
+	db_user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("User not found")
+	}
+	if err != nil {
+		return err
+	}
+	if userSuspended(db_user) {
+		return errAccountSuspended
+	}
+	return nil
+}
+
+// writeAccountSuspended rejects a login or refresh of a suspended user.
+func writeAccountSuspended(w http.ResponseWriter, db_user database.User) {
+	msg := errAccountSuspended.Error()
+	if db_user.SuspendedUntil.Valid {
+		msg += " until " + db_user.SuspendedUntil.Time.UTC().Format(time.RFC3339)
+	}
+	if db_user.SuspensionReason != "" {
+		msg += ": " + db_user.SuspensionReason
+	}
+	w.WriteHeader(403)
+	w.Write([]byte(msg))
+}
+
+// viewerID returns the user a public listing is shown to, uuid.Nil for
+// anonymous requests. An invalid token is treated as anonymous.
+func (cfg *apiConfig) viewerID(req *http.Request) uuid.UUID {
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		return uuid.Nil
+	}
+	return claims.UserID
+}
+
+type moderationResponse struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Suspended        bool       `json:"suspended"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspendedUntil   *time.Time `json:"suspended_until"`
+	SuspensionReason string     `json:"suspension_reason"`
+	ShadowBanned     bool       `json:"shadow_banned"`
+	ShadowBannedAt   *time.Time `json:"shadow_banned_at"`
+}
+
+func newModerationResponse(db_user database.User) moderationResponse {
+	res := moderationResponse{
+		UserID:           db_user.ID,
+		Suspended:        userSuspended(db_user),
+		SuspensionReason: db_user.SuspensionReason,
+		ShadowBanned:     db_user.ShadowBannedAt.Valid,
+	}
+	if db_user.SuspendedAt.Valid {
+		res.SuspendedAt = &db_user.SuspendedAt.Time
+	}
+	if db_user.SuspendedUntil.Valid {
+		res.SuspendedUntil = &db_user.SuspendedUntil.Time
+	}
+	if db_user.ShadowBannedAt.Valid {
+		res.ShadowBannedAt = &db_user.ShadowBannedAt.Time
+	}
+	return res
+}
+
+// moderateUser applies change to the user of the userID path value on behalf
+// of the calling moderator and records it in the audit log. Only admins may
+// moderate staff, and nobody may moderate themselves.
+func (cfg *apiConfig) moderateUser(w http.ResponseWriter, req *http.Request, action string, reason string, change func(ctx context.Context, q *database.Queries, userID uuid.UUID) (database.User, error)) {
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if userID == claims.UserID {
+		w.WriteHeader(400)
+		w.Write([]byte("You cannot moderate yourself"))
+		return
+	}
+	moderator, err := cfg.dbQueries.GetUserByID(req.Context(), claims.UserID)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte("User not found"))
+		return
+	}
+
+	var updated database.User
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		target, err := q.GetUserByID(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		if target.Role != auth.RoleUser && moderator.Role != auth.RoleAdmin {
+			return errStaffModeration
+		}
+		updated, err = change(req.Context(), q, userID)
+		if err != nil {
+			return err
+		}
+		diff := map[string]any{
+			"suspended":     auditChange(userSuspended(target), userSuspended(updated)),
+			"shadow_banned": auditChange(target.ShadowBannedAt.Valid, updated.ShadowBannedAt.Valid),
+		}
+		if reason != "" {
+			diff["reason"] = reason
+		}
+		if updated.SuspendedUntil.Valid {
+			diff["suspended_until"] = updated.SuspendedUntil.Time
+		}
+		return recordAudit(req.Context(), q, auditEntry{
+			Action:     action,
+			ActorID:    claims.UserID,
+			TargetType: auditTargetUser,
+			TargetID:   userID.String(),
+			Diff:       diff,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if errors.Is(err, errStaffModeration) {
+		w.WriteHeader(403)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	response_json, _ := json.Marshal(newModerationResponse(updated))
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// readModerationBody parses the reason, which is required, and the optional
+// expiry of a suspension.
+func readModerationBody(w http.ResponseWriter, req *http.Request) (reason string, expiresAt *time.Time, ok bool) {
+	type moderationBody struct {
+		Reason    string     `json:"reason"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	r_body := moderationBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return "", nil, false
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return "", nil, false
+	}
+	if strings.TrimSpace(r_body.Reason) == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("reason is required"))
+		return "", nil, false
+	}
+	return r_body.Reason, r_body.ExpiresAt, true
+}
+
+// suspendUserHandler suspends a user until expires_at, or indefinitely
+// without it. Suspended users cannot log in, their sessions end and their
+// tokens and API keys are refused until the suspension is over. Their chirps
+// are hidden.
+func (cfg *apiConfig) suspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	reason, expiresAt, ok := readModerationBody(w, req)
+	if !ok {
+		return
+	}
+	until := sql.NullTime{}
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			w.WriteHeader(400)
+			w.Write([]byte("expires_at must be in the future"))
+			return
+		}
+		until = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+	cfg.moderateUser(w, req, auditUserSuspended, reason, func(ctx context.Context, q *database.Queries, userID uuid.UUID) (database.User, error) {
+		updated, err := q.SuspendUser(ctx, database.SuspendUserParams{
+			ID:               userID,
+			SuspendedUntil:   until,
+			SuspensionReason: reason,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return updated, q.RevokeAllRefreshTokensForUser(ctx, userID)
+	})
+}
+
+func (cfg *apiConfig) unsuspendUserHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.moderateUser(w, req, auditUserUnsuspended, "", func(ctx context.Context, q *database.Queries, userID uuid.UUID) (database.User, error) {
+		return q.UnsuspendUser(ctx, userID)
+	})
+}
+
+// shadowBanUserHandler hides the chirps of a user from everyone else without
+// telling the user.
+func (cfg *apiConfig) shadowBanUserHandler(w http.ResponseWriter, req *http.Request) {
+	reason, _, ok := readModerationBody(w, req)
+	if !ok {
+		return
+	}
+	cfg.moderateUser(w, req, auditUserShadowBanned, reason, func(ctx context.Context, q *database.Queries, userID uuid.UUID) (database.User, error) {
+		return q.ShadowBanUser(ctx, userID)
+	})
+}
+
+func (cfg *apiConfig) liftShadowBanHandler(w http.ResponseWriter, req *http.Request) {
+	cfg.moderateUser(w, req, auditShadowBanLifted, "", func(ctx context.Context, q *database.Queries, userID uuid.UUID) (database.User, error) {
+		return q.LiftShadowBan(ctx, userID)
+	})
+}
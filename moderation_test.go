@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestShadowBannedChirpsVisibleOnlyToAuthor(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	moderator := createTestUser(t, cfg, auth.RoleModerator)
+	author := createTestUser(t, cfg, auth.RoleUser)
+	viewer := createTestUser(t, cfg, auth.RoleUser)
+	chirp := createTestChirp(t, cfg, author)
+
+	rec := serve(mux, "PUT", "/admin/users/"+author.ID.String()+"/shadow-ban", moderator.token, `{"reason":"spam"}`)
+	if rec.Code != 200 {
+		t.Fatalf("Expected shadow-ban to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"author", author.token, true},
+		{"other user", viewer.token, false},
+		{"anonymous", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := serve(mux, "GET", "/api/chirps/"+chirp.ID.String(), c.token, "")
+			if c.want && rec.Code != 200 || !c.want && rec.Code != 404 {
+				t.Errorf("Unexpected status %d for GET /api/chirps/{id}: %s", rec.Code, rec.Body)
+			}
+			if got := listsChirp(t, serve(mux, "GET", "/api/chirps", c.token, "").Body.Bytes(), chirp.ID); got != c.want {
+				t.Errorf("Expected chirp listed = %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+// listsChirp reports whether the chirp listing in data contains chirpID.
+func listsChirp(t *testing.T, data []byte, chirpID uuid.UUID) bool {
+	t.Helper()
+	var chirps []struct {
+		ID uuid.UUID `json:"id"`
+	}
+	err := json.Unmarshal(data, &chirps)
+	if err != nil {
+		t.Fatalf("failed to decode %q: %v", data, err)
+	}
+	for _, chirp := range chirps {
+		if chirp.ID == chirpID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationFollow         = "follow"
+	notificationFollowRequest  = "follow_request"
+	notificationFollowAccepted = "follow_accepted"
+	notificationReply          = "reply"
+	notificationMention        = "mention"
+	notificationLike           = "like"
+	notificationRechirp        = "rechirp"
+)
+
+// streamEventNotification is the live stream event type for a new or updated
+// notification.
+const streamEventNotification = "notification"
+
+var notificationTypes = []string{
+	notificationFollow,
+	notificationFollowRequest,
+	notificationFollowAccepted,
+	notificationReply,
+	notificationMention,
+	notificationLike,
+	notificationRechirp,
+}
+
+// notificationGroupKey decides which events are folded into one unread
+// notification: all new followers together, everything else per chirp.
+func notificationGroupKey(notificationType string, subjectID uuid.NullUUID) string {
+	if !subjectID.Valid {
+		return notificationType
+	}
+	return notificationType + ":" + subjectID.UUID.String()
+}
+
+func notificationSummary(notificationType string, actorCount int) string {
+	actors := "Someone"
+	if actorCount > 1 {
+		actors = fmt.Sprintf("%d people", actorCount)
+	}
+	switch notificationType {
+	case notificationFollow:
+		return actors + " followed you"
+	case notificationFollowRequest:
+		return actors + " asked to follow you"
+	case notificationFollowAccepted:
+		return actors + " accepted your follow request"
+	case notificationReply:
+		return actors + " replied to your chirp"
+	case notificationMention:
+		return actors + " mentioned you"
+	case notificationLike:
+		return actors + " liked your chirp"
+	case notificationRechirp:
+		return actors + " rechirped your chirp"
+	}
+	return actors + " interacted with you"
+}
+
+// notify stores a notification about event for recipient unless the
+// recipient turned the type off or is the actor.
+func (cfg *apiConfig) notify(ctx context.Context, event events.Event, recipient uuid.UUID, notificationType string, actor uuid.UUID, subjectID uuid.NullUUID) error {
+	if recipient == actor {
+		return nil
+	}
+	// Whatever suspended and shadow-banned users do goes unnoticed.
+	db_actor, err := cfg.dbQueries.GetUserByID(ctx, actor)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && userHidden(db_actor) {
+		return nil
+	}
+	blocked, err := cfg.blockedEitherWay(ctx, recipient, actor)
+	if err != nil {
+		return err
+	}
+	muted, err := cfg.dbQueries.IsMuted(ctx, database.IsMutedParams{
+		MuterID: recipient,
+		MutedID: actor,
+	})
+	if err != nil {
+		return err
+	}
+	if blocked || muted {
+		return nil
+	}
+	preferences, err := cfg.dbQueries.GetNotificationPreferences(ctx, recipient)
+	if err != nil {
+		return err
+	}
+	for _, preference := range preferences {
+		if preference.Type == notificationType && !preference.Enabled {
+			return nil
+		}
+	}
+	notification, err := cfg.dbQueries.UpsertNotification(ctx, database.UpsertNotificationParams{
+		Type:      notificationType,
+		GroupKey:  notificationGroupKey(notificationType, subjectID),
+		ActorID:   actor,
+		SubjectID: subjectID,
+		UserID:    recipient,
+	})
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(toResNotification(notification))
+	cfg.broker.Publish(stream.Event{
+		// One frame per domain event, even if the relay hands it over again.
+		Key:       streamEventNotification + ":" + event.ID.String(),
+		Type:      streamEventNotification,
+		Recipient: recipient,
+		Data:      data,
+	})
+	return nil
+}
+
+// notificationSink is the outbox sink that turns domain events into
+// notifications.
+func (cfg *apiConfig) notificationSink(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.UserFollowed, events.FollowRequested, events.FollowApproved:
+		payload := followEventPayload{}
+		err := json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		switch event.Type {
+		case events.FollowRequested:
+			return cfg.notify(ctx, event, payload.FolloweeID, notificationFollowRequest, payload.FollowerID, uuid.NullUUID{})
+		case events.FollowApproved:
+			return cfg.notify(ctx, event, payload.FollowerID, notificationFollowAccepted, payload.FolloweeID, uuid.NullUUID{})
+		}
+		return cfg.notify(ctx, event, payload.FolloweeID, notificationFollow, payload.FollowerID, uuid.NullUUID{})
+	case events.ChirpCreated:
+		chirp := chirpEventPayload{}
+		err := json.Unmarshal(event.Payload, &chirp)
+		if err != nil {
+			return err
+		}
+		return cfg.notifyChirpCreated(ctx, event, chirp)
+	case events.ChirpLiked, events.ChirpRechirped:
+		payload := chirpInteractionPayload{}
+		err := json.Unmarshal(event.Payload, &payload)
+		if err != nil {
+			return err
+		}
+		notificationType := notificationLike
+		if event.Type == events.ChirpRechirped {
+			notificationType = notificationRechirp
+		}
+		return cfg.notify(ctx, event, payload.AuthorID, notificationType, payload.UserID, uuid.NullUUID{UUID: payload.ChirpID, Valid: true})
+	}
+	return nil
+}
+
+// notifyChirpCreated tells the author of the replied-to chirp about a reply
+// and the mentioned users about a mention. Replies group per replied-to
+// chirp, mentions per mentioning chirp.
+func (cfg *apiConfig) notifyChirpCreated(ctx context.Context, event events.Event, chirp chirpEventPayload) error {
+	var replyRecipient uuid.UUID
+	if chirp.ReplyToID != nil {
+		parent, err := cfg.dbQueries.GetChirp(ctx, *chirp.ReplyToID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		// A parent deleted in the meantime has nobody left to tell.
+		if err == nil {
+			replyRecipient = parent.UserID
+			err = cfg.notifyAboutChirp(ctx, event, parent.UserID, notificationReply, chirp.UserID, parent.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	handles := mentionedHandles(chirp.Body)
+	if len(handles) == 0 {
+		return nil
+	}
+	mentioned, err := cfg.dbQueries.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+	for _, user := range mentioned {
+		// Mentioning the author of the replied-to chirp is part of the reply.
+		if user.ID == replyRecipient {
+			continue
+		}
+		err = cfg.notifyAboutChirp(ctx, event, user.ID, notificationMention, chirp.UserID, chirp.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyAboutChirp notifies recipient about a chirp of author, unless the
+// recipient is not allowed to read it.
+func (cfg *apiConfig) notifyAboutChirp(ctx context.Context, event events.Event, recipient uuid.UUID, notificationType string, author uuid.UUID, subjectID uuid.UUID) error {
+	visible, err := cfg.dbQueries.CanViewChirpsOf(ctx, database.CanViewChirpsOfParams{
+		AuthorID: author,
+		ViewerID: recipient,
+	})
+	if err != nil || !visible {
+		return err
+	}
+	return cfg.notify(ctx, event, recipient, notificationType, author, uuid.NullUUID{UUID: subjectID, Valid: true})
+}
+
+// resNotification is a notification as the API returns it. The id of a
+// notification never changes, its seq grows whenever another event is folded
+// into it. Listing and marking as read go by seq.
+type resNotification struct {
+	ID         int64       `json:"id"`
+	Seq        int64       `json:"seq"`
+	Type       string      `json:"type"`
+	Summary    string      `json:"summary"`
+	ActorIDs   []uuid.UUID `json:"actor_ids"`
+	ActorCount int         `json:"actor_count"`
+	SubjectID  *uuid.UUID  `json:"subject_id,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Read       bool        `json:"read"`
+}
+
+func toResNotification(notification database.Notification) resNotification {
+	res := resNotification{
+		ID:         notification.ID,
+		Seq:        notification.Seq,
+		Type:       notification.Type,
+		Summary:    notificationSummary(notification.Type, len(notification.ActorIds)),
+		ActorIDs:   notification.ActorIds,
+		ActorCount: len(notification.ActorIds),
+		CreatedAt:  notification.CreatedAt,
+		UpdatedAt:  notification.UpdatedAt,
+		Read:       notification.ReadAt.Valid,
+	}
+	if notification.SubjectID.Valid {
+		res.SubjectID = &notification.SubjectID.UUID
+	}
+	return res
+}
+
+func (cfg *apiConfig) getNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	before := int64(math.MaxInt64)
+	if beforeStr := req.URL.Query().Get("before"); beforeStr != "" {
+		before, err = strconv.ParseInt(beforeStr, 10, 64)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte("before must be a notification seq"))
+			return
+		}
+	}
+	limit := int32(20)
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 100 {
+			w.WriteHeader(400)
+			w.Write([]byte("limit must be between 1 and 100"))
+			return
+		}
+		limit = int32(parsed)
+	}
+
+	notifications, err := cfg.dbQueries.ListNotifications(req.Context(), database.ListNotificationsParams{
+		UserID: userID,
+		Seq:    before,
+		Limit:  limit,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	unread, err := cfg.dbQueries.CountUnreadNotifications(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	type res_body struct {
+		Notifications []resNotification `json:"notifications"`
+		UnreadCount   int64             `json:"unread_count"`
+		NextBefore    *int64            `json:"next_before,omitempty"`
+	}
+	res := res_body{
+		Notifications: []resNotification{},
+		UnreadCount:   unread,
+	}
+	for _, notification := range notifications {
+		res.Notifications = append(res.Notifications, toResNotification(notification))
+	}
+	if len(notifications) == int(limit) {
+		res.NextBefore = &notifications[len(notifications)-1].Seq
+	}
+	response_json, _ := json.Marshal(res)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) readNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	type req_body struct {
+		UpToSeq *int64 `json:"up_to_seq"`
+	}
+	r_body := req_body{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(r_data) > 0 {
+		err = json.Unmarshal(r_data, &r_body)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	upToSeq := int64(math.MaxInt64)
+	if r_body.UpToSeq != nil {
+		upToSeq = *r_body.UpToSeq
+	}
+
+	marked, err := cfg.dbQueries.MarkNotificationsReadUpTo(req.Context(), database.MarkNotificationsReadUpToParams{
+		UserID: userID,
+		Seq:    upToSeq,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	unread, err := cfg.dbQueries.CountUnreadNotifications(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	type res_body struct {
+		Marked      int64 `json:"marked"`
+		UnreadCount int64 `json:"unread_count"`
+	}
+	response_json, _ := json.Marshal(res_body{Marked: marked, UnreadCount: unread})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) getNotificationPreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cfg.writeNotificationPreferences(w, req.Context(), userID)
+}
+
+func (cfg *apiConfig) updateNotificationPreferencesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	r_body := map[string]bool{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	for notificationType := range r_body {
+		known := false
+		for _, t := range notificationTypes {
+			known = known || t == notificationType
+		}
+		if !known {
+			w.WriteHeader(400)
+			w.Write([]byte("unknown notification type " + notificationType))
+			return
+		}
+	}
+
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		for notificationType, enabled := range r_body {
+			err := q.UpsertNotificationPreference(req.Context(), database.UpsertNotificationPreferenceParams{
+				Type:    notificationType,
+				Enabled: enabled,
+				UserID:  userID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cfg.writeNotificationPreferences(w, req.Context(), userID)
+}
+
+// writeNotificationPreferences responds with every notification type, types
+// without a stored preference are enabled.
+func (cfg *apiConfig) writeNotificationPreferences(w http.ResponseWriter, ctx context.Context, userID uuid.UUID) {
+	preferences, err := cfg.dbQueries.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res := map[string]bool{}
+	for _, notificationType := range notificationTypes {
+		res[notificationType] = true
+	}
+	for _, preference := range preferences {
+		res[preference.Type] = preference.Enabled
+	}
+	response_json, _ := json.Marshal(res)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
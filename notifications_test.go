@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+// dispatchNotifications hands every pending outbox event to the
+// notification sink.
+func dispatchNotifications(t *testing.T, cfg *apiConfig) {
+	t.Helper()
+	relay := events.NewRelay(outboxStore{queries: cfg.dbQueries}, map[string]events.Sink{
+		"notifications": events.SinkFunc(cfg.notificationSink),
+	})
+	_, err := relay.DispatchPending(context.Background())
+	if err != nil {
+		t.Fatal("failed to dispatch events:", err)
+	}
+}
+
+func listTestNotifications(t *testing.T, cfg *apiConfig, userID uuid.UUID) []database.Notification {
+	t.Helper()
+	notifications, err := cfg.dbQueries.ListNotifications(context.Background(), database.ListNotificationsParams{
+		UserID: userID,
+		Seq:    math.MaxInt64,
+		Limit:  50,
+	})
+	if err != nil {
+		t.Fatal("failed to list notifications:", err)
+	}
+	return notifications
+}
+
+func TestLikesGroupPerChirp(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	author := createTestUser(t, cfg, auth.RoleUser)
+	chirp := createTestChirp(t, cfg, author)
+	path := "/api/chirps/" + chirp.ID.String() + "/like"
+
+	for i := 0; i < 3; i++ {
+		fan := createTestUser(t, cfg, auth.RoleUser)
+		rec := serve(mux, "POST", path, fan.token, "")
+		if rec.Code != 204 {
+			t.Fatalf("Expected like to succeed, got %d: %s", rec.Code, rec.Body)
+		}
+		// Liking twice is not a second like.
+		serve(mux, "POST", path, fan.token, "")
+	}
+	rec := serve(mux, "POST", path, author.token, "")
+	if rec.Code != 204 {
+		t.Fatalf("Expected the author to like their own chirp, got %d: %s", rec.Code, rec.Body)
+	}
+	dispatchNotifications(t, cfg)
+
+	notifications := listTestNotifications(t, cfg, author.ID)
+	if len(notifications) != 1 {
+		t.Fatalf("Expected one notification, got %d", len(notifications))
+	}
+	res := toResNotification(notifications[0])
+	if res.Type != notificationLike || res.Summary != "3 people liked your chirp" {
+		t.Errorf("Unexpected notification: %+v", res)
+	}
+	if res.SubjectID == nil || *res.SubjectID != chirp.ID {
+		t.Errorf("Expected the liked chirp as subject, got %v", res.SubjectID)
+	}
+}
+
+func TestRechirpOfHiddenChirpRejected(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	author := createTestUser(t, cfg, auth.RoleUser)
+	stranger := createTestUser(t, cfg, auth.RoleUser)
+	chirp := createTestChirp(t, cfg, author)
+
+	rec := serve(mux, "PUT", "/api/users/privacy", author.token, `{"is_private":true}`)
+	if rec.Code != 200 {
+		t.Fatalf("Expected privacy update to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "POST", "/api/chirps/"+chirp.ID.String()+"/rechirp", stranger.token, "")
+	if rec.Code != 404 {
+		t.Errorf("Expected 404 for a chirp the caller cannot see, got %d: %s", rec.Code, rec.Body)
+	}
+	dispatchNotifications(t, cfg)
+	if notifications := listTestNotifications(t, cfg, author.ID); len(notifications) != 0 {
+		t.Errorf("Expected no notifications, got %d", len(notifications))
+	}
+}
+
+func TestReplyAndMentionNotifications(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	author := createTestUser(t, cfg, auth.RoleUser)
+	replier := createTestUser(t, cfg, auth.RoleUser)
+	friend := createTestUser(t, cfg, auth.RoleUser)
+	chirp := createTestChirp(t, cfg, author)
+
+	rec := serve(mux, "PUT", "/api/users/handle", friend.token, `{"handle":"@Friend"}`)
+	if rec.Code != 200 {
+		t.Fatalf("Expected handle update to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(mux, "PUT", "/api/users/handle", author.token, `{"handle":"friend"}`)
+	if rec.Code != 409 {
+		t.Errorf("Expected 409 for a taken handle, got %d: %s", rec.Code, rec.Body)
+	}
+
+	body := `{"body":"agreed, @friend","reply_to_id":"` + chirp.ID.String() + `"}`
+	rec = serve(mux, "POST", "/api/chirps", replier.token, body)
+	if rec.Code != 201 {
+		t.Fatalf("Expected reply to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	dispatchNotifications(t, cfg)
+
+	notifications := listTestNotifications(t, cfg, author.ID)
+	if len(notifications) != 1 || notifications[0].Type != notificationReply {
+		t.Fatalf("Expected one reply notification, got %+v", notifications)
+	}
+	if notifications[0].SubjectID.UUID != chirp.ID {
+		t.Errorf("Expected the replied-to chirp as subject, got %v", notifications[0].SubjectID)
+	}
+	notifications = listTestNotifications(t, cfg, friend.ID)
+	if len(notifications) != 1 || notifications[0].Type != notificationMention {
+		t.Fatalf("Expected one mention notification, got %+v", notifications)
+	}
+	if notifications[0].ActorIds[0] != replier.ID {
+		t.Errorf("Expected the replier as actor, got %v", notifications[0].ActorIds)
+	}
+}
+
+func TestMentionedHandles(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"hi @Alice and @bob_2, @alice again", []string{"alice", "bob_2"}},
+		{"mail me at carol@example.com", []string{}},
+		{"@ab is too short", []string{}},
+		{"@dave.", []string{"dave"}},
+	}
+	for _, c := range cases {
+		got := mentionedHandles(c.body)
+		if len(got) != len(c.want) {
+			t.Errorf("mentionedHandles(%q) = %v, want %v", c.body, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("mentionedHandles(%q) = %v, want %v", c.body, got, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/oauth"
+	"github.com/google/uuid"
+)
+
+var (
+	errIncorrectLogin = errors.New("Incorrect email or password")
+	errTOTPRequired   = errors.New("Enter the code of your authenticator app")
+	errTooManyLogins  = errors.New("Too many failed login attempts, try again later")
+)
+
+// publicBaseURL is the URL the API is reachable under from browsers, set
+// with OAUTH_ISSUER.
+func publicBaseURL() string {
+	baseURL := os.Getenv("OAUTH_ISSUER")
+	if baseURL == "" {
+		return "http://localhost:8080"
+	}
+	return strings.TrimSuffix(baseURL, "/")
+}
+
+// newOAuthServer sets up the authorization server for third-party apps.
+func (cfg *apiConfig) newOAuthServer() *oauth.Server {
+	return oauth.NewServer(oauthStore{db: cfg.dbQueries}, cfg.jwtKeys, publicBaseURL(), cfg.oauthLogin)
+}
+
+// oauthLogin checks the credentials entered on the consent screen. Users
+// with two-factor authentication also enter a TOTP code.
+func (cfg *apiConfig) oauthLogin(req *http.Request) (uuid.UUID, error) {
+	email := req.PostForm.Get("email")
+	if cfg.loginWait(req, email) > 0 {
+		return uuid.Nil, errTooManyLogins
+	}
+	db_user, err := cfg.dbQueries.GetUserByMail(req.Context(), email)
+	if err != nil {
+		cfg.loginFailed(req, email, uuid.Nil, "unknown_account")
+		return uuid.Nil, errIncorrectLogin
+	}
+	err = cfg.verifyPassword(req.Context(), db_user, req.PostForm.Get("password"))
+	if err != nil {
+		cfg.loginFailed(req, email, db_user.ID, "password")
+		return uuid.Nil, errIncorrectLogin
+	}
+	if db_user.TotpEnabledAt.Valid {
+		code := req.PostForm.Get("code")
+		if code == "" {
+			return uuid.Nil, errTOTPRequired
+		}
+		err = cfg.useTOTPCode(req, db_user, code)
+		if err != nil {
+			cfg.loginFailed(req, email, db_user.ID, "mfa_code")
+			return uuid.Nil, err
+		}
+	}
+	if userSuspended(db_user) {
+		return uuid.Nil, errAccountSuspended
+	}
+	cfg.loginSucceeded(req, email)
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action:     auditLogin,
+		ActorID:    db_user.ID,
+		TargetType: auditTargetUser,
+		TargetID:   db_user.ID.String(),
+		Diff:       map[string]any{"oauth_client_id": req.PostForm.Get("client_id")},
+	})
+	return db_user.ID, nil
+}
+
+type oauthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClientResponse(client database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func (cfg *apiConfig) createOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	type createBody struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if claims.SessionID == uuid.Nil {
+		w.WriteHeader(403)
+		w.Write([]byte("OAuth clients can only be registered from a login session"))
+		return
+	}
+
+	r_body := createBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	client, secret, err := oauth.NewClient(claims.UserID, r_body.Name, r_body.RedirectURIs, r_body.Scopes, r_body.Public)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	db_client, err := cfg.dbQueries.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		ID:           client.ID,
+		SecretHash:   sql.NullString{String: client.SecretHash, Valid: !client.Public()},
+		Name:         client.Name,
+		RedirectUris: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		UserID:       client.OwnerID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// The secret is only shown this once.
+	res_body := newOAuthClientResponse(db_client)
+	res_body.ClientSecret = secret
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(201)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) listOAuthClientsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	clients, err := cfg.dbQueries.ListOAuthClients(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []oauthClientResponse{}
+	for _, client := range clients {
+		res_body = append(res_body, newOAuthClientResponse(client))
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// deleteOAuthClientHandler removes a client together with its codes and
+// refresh tokens.
+func (cfg *apiConfig) deleteOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+		ID:     req.PathValue("clientID"),
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("OAuth client not found"))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// oauthStore backs the authorization server with Postgres.
+type oauthStore struct {
+	db *database.Queries
+}
+
+func oauthNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauth.ErrNotFound
+	}
+	return err
+}
+
+func (s oauthStore) CreateClient(ctx context.Context, client oauth.Client) error {
+	_, err := s.db.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		ID:           client.ID,
+		SecretHash:   sql.NullString{String: client.SecretHash, Valid: !client.Public()},
+		Name:         client.Name,
+		RedirectUris: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		UserID:       client.OwnerID,
+	})
+	return err
+}
+
+func (s oauthStore) GetClient(ctx context.Context, clientID string) (oauth.Client, error) {
+	client, err := s.db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return oauth.Client{}, oauthNotFound(err)
+	}
+	return oauth.Client{
+		ID:           client.ID,
+		SecretHash:   client.SecretHash.String,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		OwnerID:      client.UserID,
+		CreatedAt:    client.CreatedAt,
+	}, nil
+}
+
+func (s oauthStore) CreateCode(ctx context.Context, code oauth.Code) error {
+	return s.db.CreateOAuthCode(ctx, database.CreateOAuthCodeParams{
+		CodeHash:      code.Hash,
+		GrantID:       code.GrantID,
+		RedirectUri:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		CodeChallenge: code.CodeChallenge,
+		Nonce:         code.Nonce,
+		AuthTime:      code.AuthTime,
+		ExpiresAt:     code.ExpiresAt,
+		ClientID:      code.ClientID,
+		UserID:        code.UserID,
+	})
+}
+
+func (s oauthStore) UseCode(ctx context.Context, hash string) (oauth.Code, error) {
+	row, err := s.db.GetOAuthCode(ctx, hash)
+	if err != nil {
+		return oauth.Code{}, oauthNotFound(err)
+	}
+	code := oauth.Code{
+		Hash:          row.CodeHash,
+		ClientID:      row.ClientID,
+		UserID:        row.UserID,
+		GrantID:       row.GrantID,
+		RedirectURI:   row.RedirectUri,
+		Scopes:        row.Scopes,
+		CodeChallenge: row.CodeChallenge,
+		Nonce:         row.Nonce,
+		AuthTime:      row.AuthTime,
+		ExpiresAt:     row.ExpiresAt,
+	}
+	used, err := s.db.UseOAuthCode(ctx, hash)
+	if err != nil {
+		return oauth.Code{}, err
+	}
+	if used == 0 {
+		return code, oauth.ErrReused
+	}
+	return code, nil
+}
+
+func (s oauthStore) CreateRefreshToken(ctx context.Context, token oauth.RefreshToken) error {
+	return s.db.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		TokenHash: token.Hash,
+		GrantID:   token.GrantID,
+		Scopes:    token.Scopes,
+		AuthTime:  token.AuthTime,
+		ExpiresAt: token.ExpiresAt,
+		ClientID:  token.ClientID,
+		UserID:    token.UserID,
+	})
+}
+
+func (s oauthStore) GetRefreshToken(ctx context.Context, hash string) (oauth.RefreshToken, error) {
+	row, err := s.db.GetOAuthRefreshToken(ctx, hash)
+	if err != nil {
+		return oauth.RefreshToken{}, oauthNotFound(err)
+	}
+	return oauth.RefreshToken{
+		Hash:      row.TokenHash,
+		ClientID:  row.ClientID,
+		UserID:    row.UserID,
+		GrantID:   row.GrantID,
+		Scopes:    row.Scopes,
+		AuthTime:  row.AuthTime,
+		ExpiresAt: row.ExpiresAt,
+		Revoked:   row.RevokedAt.Valid,
+	}, nil
+}
+
+func (s oauthStore) UseRefreshToken(ctx context.Context, hash string) (oauth.RefreshToken, error) {
+	token, err := s.GetRefreshToken(ctx, hash)
+	if err != nil {
+		return oauth.RefreshToken{}, err
+	}
+	// Suspended users keep their grants but cannot use them.
+	db_user, err := s.db.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return oauth.RefreshToken{}, oauthNotFound(err)
+	}
+	if userSuspended(db_user) {
+		return oauth.RefreshToken{}, oauth.ErrNotFound
+	}
+	used, err := s.db.UseOAuthRefreshToken(ctx, hash)
+	if err != nil {
+		return oauth.RefreshToken{}, err
+	}
+	if used == 0 {
+		return token, oauth.ErrReused
+	}
+	return token, nil
+}
+
+func (s oauthStore) RevokeGrant(ctx context.Context, grantID uuid.UUID) error {
+	return s.db.RevokeOAuthGrant(ctx, grantID)
+}
+
+func (s oauthStore) UserInfo(ctx context.Context, userID uuid.UUID) (oauth.UserInfo, error) {
+	db_user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return oauth.UserInfo{}, oauthNotFound(err)
+	}
+	return oauth.UserInfo{
+		Email:         db_user.Email,
+		EmailVerified: db_user.EmailVerifiedAt.Valid,
+	}, nil
+}
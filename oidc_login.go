@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcFlowCookie = "chirpy_oidc_flow"
+	oidcFlowTTL    = 10 * time.Minute
+)
+
+var (
+	errIdentityNoEmail    = errors.New("The identity provider did not share an email address")
+	errIdentityEmailTaken = errors.New("An account with this email already exists, sign in and link the provider from your account")
+	errIdentityLinked     = errors.New("This identity is already linked to an account")
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+type oidcProvider struct {
+	*oidc.Provider
+	name string
+	// linkByEmail signs in existing accounts whose email the provider
+	// reports as verified. Only for providers that own the email domain,
+	// e.g. the corporate IdP, as anyone else could claim the address.
+	linkByEmail bool
+}
+
+// loadOIDCProviders reads the external identity providers. OIDC_PROVIDERS
+// is a comma separated list of names; provider corp is configured with
+// OIDC_CORP_ISSUER, OIDC_CORP_CLIENT_ID, OIDC_CORP_CLIENT_SECRET and
+// optionally OIDC_CORP_LINK_BY_EMAIL=true.
+func loadOIDCProviders() map[string]*oidcProvider {
+	providers := map[string]*oidcProvider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			log.Fatalf("Invalid OIDC provider name %q", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  publicBaseURL() + "/api/login/oidc/" + name + "/callback",
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Fatalf("OIDC provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers[name] = &oidcProvider{
+			Provider:    oidc.NewProvider(config),
+			name:        name,
+			linkByEmail: os.Getenv(prefix+"LINK_BY_EMAIL") == "true",
+		}
+	}
+	return providers
+}
+
+// oidcFlowKey signs the login flow cookie.
+func (cfg *apiConfig) oidcFlowKey() []byte {
+	return []byte(auth.HashToken("oidc-flow", cfg.secretKey))
+}
+
+// startOIDCFlow stores a new flow in a cookie and returns the provider URL
+// to send the browser to.
+func (cfg *apiConfig) startOIDCFlow(w http.ResponseWriter, req *http.Request, provider *oidcProvider, linkUserID uuid.UUID) (string, error) {
+	flow, err := oidc.NewFlow(provider.name, oidcFlowTTL)
+	if err != nil {
+		return "", err
+	}
+	flow.LinkUserID = linkUserID
+	authURL, err := provider.AuthCodeURL(req.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		return "", err
+	}
+	// Lax still sends the cookie on the top-level redirect back from the
+	// provider.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    flow.Seal(cfg.oidcFlowKey()),
+		Path:     "/api",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(publicBaseURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, nil
+}
+
+func (cfg *apiConfig) oidcProviderFromPath(w http.ResponseWriter, req *http.Request) *oidcProvider {
+	provider, ok := cfg.oidcProviders[req.PathValue("provider")]
+	if !ok {
+		w.WriteHeader(404)
+		w.Write([]byte("Unknown identity provider"))
+		return nil
+	}
+	return provider
+}
+
+func (cfg *apiConfig) oidcLoginHandler(w http.ResponseWriter, req *http.Request) {
+	provider := cfg.oidcProviderFromPath(w, req)
+	if provider == nil {
+		return
+	}
+	authURL, err := cfg.startOIDCFlow(w, req, provider, uuid.Nil)
+	if err != nil {
+		log.Printf("oidc: starting login with %s: %v", provider.name, err)
+		w.WriteHeader(502)
+		w.Write([]byte("The identity provider is not available"))
+		return
+	}
+	http.Redirect(w, req, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes a login or link flow when the provider sends
+// the browser back.
+func (cfg *apiConfig) oidcCallbackHandler(w http.ResponseWriter, req *http.Request) {
+	provider := cfg.oidcProviderFromPath(w, req)
+	if provider == nil {
+		return
+	}
+	cookie, err := req.Cookie(oidcFlowCookie)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(oidc.ErrInvalidFlow.Error()))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: "/api", MaxAge: -1})
+	flow, err := oidc.OpenFlow(cookie.Value, cfg.oidcFlowKey(), time.Now())
+	if err != nil || flow.Provider != provider.name || flow.State != req.URL.Query().Get("state") {
+		w.WriteHeader(400)
+		w.Write([]byte(oidc.ErrInvalidFlow.Error()))
+		return
+	}
+	if req.URL.Query().Has("error") {
+		w.WriteHeader(401)
+		w.Write([]byte("Sign in was cancelled or denied: " + req.URL.Query().Get("error")))
+		return
+	}
+
+	idToken, err := provider.Exchange(req.Context(), req.URL.Query().Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc: callback from %s: %v", provider.name, err)
+		w.WriteHeader(401)
+		w.Write([]byte("Sign in with the identity provider failed"))
+		return
+	}
+
+	if flow.LinkUserID != uuid.Nil {
+		identity, err := cfg.linkIdentity(req.Context(), cfg.dbQueries, provider, idToken, flow.LinkUserID)
+		if errors.Is(err, errIdentityLinked) {
+			w.WriteHeader(409)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		response_json, _ := json.Marshal(newIdentityResponse(identity))
+		w.WriteHeader(200)
+		w.Write(response_json)
+		return
+	}
+
+	db_user, err := cfg.userForIdentity(req, provider, idToken)
+	switch {
+	case errors.Is(err, errIdentityNoEmail):
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	case errors.Is(err, errIdentityEmailTaken):
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if db_user.TotpEnabledAt.Valid {
+		cfg.startMFAChallenge(w, db_user)
+		return
+	}
+	cfg.completeLogin(w, req, db_user)
+}
+
+func (cfg *apiConfig) linkIdentity(ctx context.Context, q *database.Queries, provider *oidcProvider, idToken *oidc.IDToken, userID uuid.UUID) (database.UserIdentity, error) {
+	identity, err := q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider.name,
+		Subject:  idToken.Subject,
+		Email:    idToken.Email,
+		UserID:   userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.UserIdentity{}, errIdentityLinked
+	}
+	return identity, err
+}
+
+// userForIdentity returns the user an external identity signs in as. New
+// identities get a new passwordless account, unless the email belongs to an
+// existing account, which only providers trusted with linkByEmail may sign
+// in to.
+func (cfg *apiConfig) userForIdentity(req *http.Request, provider *oidcProvider, idToken *oidc.IDToken) (database.User, error) {
+	identity, err := cfg.dbQueries.GetUserIdentity(req.Context(), database.GetUserIdentityParams{
+		Provider: provider.name,
+		Subject:  idToken.Subject,
+	})
+	if err == nil {
+		err = cfg.dbQueries.TouchUserIdentity(req.Context(), database.TouchUserIdentityParams{
+			Provider: provider.name,
+			Subject:  idToken.Subject,
+			Email:    idToken.Email,
+		})
+		if err != nil {
+			log.Printf("oidc: recording login of %s/%s: %v", provider.name, idToken.Subject, err)
+		}
+		return cfg.dbQueries.GetUserByID(req.Context(), identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	if idToken.Email == "" {
+		return database.User{}, errIdentityNoEmail
+	}
+
+	existing, err := cfg.dbQueries.GetUserByMail(req.Context(), idToken.Email)
+	if err == nil {
+		// Only an account whose owner proved the address may be linked,
+		// otherwise whoever registered it first with a password of their
+		// own would share it with the provider's user.
+		if !provider.linkByEmail || !idToken.EmailVerified || !existing.EmailVerifiedAt.Valid {
+			return database.User{}, errIdentityEmailTaken
+		}
+		_, err = cfg.linkIdentity(req.Context(), cfg.dbQueries, provider, idToken, existing.ID)
+		if errors.Is(err, errIdentityLinked) {
+			return database.User{}, errIdentityEmailTaken
+		}
+		return existing, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	var db_user database.User
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		db_user, err = q.CreatePasswordlessUser(req.Context(), database.CreatePasswordlessUserParams{
+			Email:           idToken.Email,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: idToken.EmailVerified},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = cfg.linkIdentity(req.Context(), q, provider, idToken, db_user.ID)
+		if err != nil {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.UserCreated, db_user.ID, map[string]any{
+			"id":         db_user.ID,
+			"created_at": db_user.CreatedAt,
+		})
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if !db_user.EmailVerifiedAt.Valid {
+		err = cfg.sendVerificationEmail(req.Context(), db_user)
+		if err != nil {
+			log.Printf("email verification: sending to user %s: %v", db_user.ID, err)
+		}
+	}
+	return cfg.bootstrapAdmin(req.Context(), db_user), nil
+}
+
+type identityResponse struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func newIdentityResponse(identity database.UserIdentity) identityResponse {
+	return identityResponse{
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		CreatedAt:   identity.CreatedAt,
+		LastLoginAt: nullTimePtr(identity.LastLoginAt),
+	}
+}
+
+// linkIdentityHandler starts a flow that links an identity to the signed in
+// user. The client navigates the browser to the returned URL.
+func (cfg *apiConfig) linkIdentityHandler(w http.ResponseWriter, req *http.Request) {
+	type linkResponse struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if claims.SessionID == uuid.Nil {
+		w.WriteHeader(403)
+		w.Write([]byte("Identities can only be linked from a login session"))
+		return
+	}
+	provider := cfg.oidcProviderFromPath(w, req)
+	if provider == nil {
+		return
+	}
+	authURL, err := cfg.startOIDCFlow(w, req, provider, claims.UserID)
+	if err != nil {
+		log.Printf("oidc: starting link with %s: %v", provider.name, err)
+		w.WriteHeader(502)
+		w.Write([]byte("The identity provider is not available"))
+		return
+	}
+	response_json, _ := json.Marshal(linkResponse{AuthorizationURL: authURL})
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) listIdentitiesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	identities, err := cfg.dbQueries.ListUserIdentities(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []identityResponse{}
+	for _, identity := range identities {
+		res_body = append(res_body, newIdentityResponse(identity))
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// unlinkIdentityHandler removes an identity, unless it is the only way a
+// passwordless user can sign in.
+func (cfg *apiConfig) unlinkIdentityHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	db_user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if !db_user.HashedPassword.Valid {
+		count, err := cfg.dbQueries.CountUserIdentities(req.Context(), userID)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if count <= 1 {
+			w.WriteHeader(409)
+			w.Write([]byte("Set a password before removing your only way to sign in"))
+			return
+		}
+	}
+	deleted, err := cfg.dbQueries.DeleteUserIdentity(req.Context(), database.DeleteUserIdentityParams{
+		UserID:   userID,
+		Provider: req.PathValue("provider"),
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("Identity not found"))
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+type chirpEventPayload struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+}
+
+func newChirpEventPayload(chirp database.Chirp) chirpEventPayload {
+	payload := chirpEventPayload{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+	}
+	if chirp.ReplyToID.Valid {
+		payload.ReplyToID = &chirp.ReplyToID.UUID
+	}
+	return payload
+}
+
+// withTx runs fn in a database transaction and wakes the outbox relay once
+// the transaction committed.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(cfg.dbQueries.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	if cfg.outbox != nil {
+		cfg.outbox.Wake()
+	}
+	return nil
+}
+
+// recordEvent writes a domain event to the outbox. q must belong to the
+// transaction that performs the state change the event describes.
+func recordEvent(ctx context.Context, q *database.Queries, eventType string, aggregateID uuid.UUID, data any) error {
+	event, err := events.New(eventType, aggregateID, data)
+	if err != nil {
+		return err
+	}
+	return q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		ID:          event.ID,
+		EventType:   event.Type,
+		AggregateID: event.AggregateID,
+		Payload:     event.Payload,
+		OccurredAt:  event.OccurredAt,
+	})
+}
+
+// outboxStore lets the relay claim due events with FOR UPDATE SKIP LOCKED,
+// so several server instances can run a relay without double dispatching.
+// The claim pushes next_attempt_at past the relay's lease instead of holding
+// the rows locked while the sinks run.
+type outboxStore struct {
+	queries *database.Queries
+}
+
+func (s outboxStore) ClaimDue(ctx context.Context, now time.Time, limit, maxAttempts int, lockedUntil time.Time) ([]events.Pending, error) {
+	rows, err := s.queries.ClaimDueOutboxEvents(ctx, database.ClaimDueOutboxEventsParams{
+		Now:         now,
+		MaxAttempts: int32(maxAttempts),
+		BatchSize:   int32(limit),
+		LockedUntil: lockedUntil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING does not keep the order of the claim.
+	slices.SortFunc(rows, func(a, b database.ClaimDueOutboxEventsRow) int {
+		return a.OccurredAt.Compare(b.OccurredAt)
+	})
+	batch := make([]events.Pending, 0, len(rows))
+	for _, row := range rows {
+		batch = append(batch, events.Pending{
+			Event: events.Event{
+				ID:          row.ID,
+				Type:        row.EventType,
+				AggregateID: row.AggregateID,
+				Payload:     row.Payload,
+				OccurredAt:  row.OccurredAt,
+			},
+			Attempts: int(row.Attempts),
+			Handled:  row.HandledBy,
+		})
+	}
+	return batch, nil
+}
+
+func (s outboxStore) MarkDispatched(ctx context.Context, id uuid.UUID) error {
+	return s.queries.MarkOutboxEventDispatched(ctx, id)
+}
+
+func (s outboxStore) MarkFailed(ctx context.Context, id uuid.UUID, handled []string, err error, nextAttemptAt time.Time) error {
+	return s.queries.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+		ID:            id,
+		LastError:     sql.NullString{String: err.Error(), Valid: true},
+		HandledBy:     handled,
+		NextAttemptAt: nextAttemptAt,
+	})
+}
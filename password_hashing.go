@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+)
+
+// loadPasswordHasher configures how new passwords are hashed:
+// PASSWORD_HASH_ALGORITHM (argon2id or bcrypt), ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS, ARGON2_PARALLELISM and BCRYPT_COST. Changing them
+// upgrades existing hashes as their users log in.
+func loadPasswordHasher() *auth.PasswordHasher {
+	hasher := *auth.DefaultPasswordHasher
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		if algorithm != auth.Argon2id && algorithm != auth.Bcrypt {
+			log.Fatalf("Invalid PASSWORD_HASH_ALGORITHM %q", algorithm)
+		}
+		hasher.Algorithm = algorithm
+	}
+	hasher.Argon2id.Memory = uint32(envUint("ARGON2_MEMORY_KIB", uint64(hasher.Argon2id.Memory), 32))
+	hasher.Argon2id.Iterations = uint32(envUint("ARGON2_ITERATIONS", uint64(hasher.Argon2id.Iterations), 32))
+	hasher.Argon2id.Parallelism = uint8(envUint("ARGON2_PARALLELISM", uint64(hasher.Argon2id.Parallelism), 8))
+	hasher.BcryptCost = int(envUint("BCRYPT_COST", uint64(hasher.BcryptCost), 8))
+	return &hasher
+}
+
+// envUint reads the unsigned integer variable name, fallback if unset.
+func envUint(name string, fallback uint64, bits int) uint64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseUint(value, 10, bits)
+	if err != nil || parsed == 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
+	}
+	return parsed
+}
+
+// verifyPassword checks password against the hash of db_user. A hash made
+// with outdated settings is replaced while the password is known; failing
+// to do so does not fail the login.
+func (cfg *apiConfig) verifyPassword(ctx context.Context, db_user database.User, password string) error {
+	needsRehash, err := cfg.passwordHasher.Verify(password, db_user.HashedPassword.String)
+	if err != nil || !needsRehash {
+		return err
+	}
+	newHash, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("password rehash for user %s: %v", db_user.ID, err)
+		return nil
+	}
+	// Only replaces the hash that was verified, never a password changed in
+	// the meantime.
+	_, err = cfg.dbQueries.UpgradeUserPasswordHash(ctx, database.UpgradeUserPasswordHashParams{
+		NewHash: sql.NullString{String: newHash, Valid: true},
+		ID:      db_user.ID,
+		OldHash: db_user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("password rehash for user %s: %v", db_user.ID, err)
+	}
+	return nil
+}
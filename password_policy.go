@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/password"
+)
+
+// loadPasswordChecker builds the password policy from the environment:
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_ENTROPY (bits) and
+// BREACHED_PASSWORDS_DIR, a directory of k-anonymity range files.
+func loadPasswordChecker() *password.Checker {
+	policy := password.DefaultPolicy
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		minLength, err := strconv.Atoi(value)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+		policy.MinLength = minLength
+	}
+	if value := os.Getenv("PASSWORD_MIN_ENTROPY"); value != "" {
+		minEntropy, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid PASSWORD_MIN_ENTROPY: %v", err)
+		}
+		policy.MinEntropy = minEntropy
+	}
+	corpora := []password.Corpus{}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			log.Fatalf("BREACHED_PASSWORDS_DIR %s is not a directory", dir)
+		}
+		corpora = append(corpora, password.RangeDir(dir))
+	}
+	return password.NewChecker(policy, corpora...)
+}
+
+// writePasswordError answers a request whose password failed validation with
+// the list of requirements it did not meet.
+func writePasswordError(w http.ResponseWriter, err error) {
+	type violationsResponse struct {
+		Error      string               `json:"error"`
+		Violations []password.Violation `json:"violations"`
+	}
+
+	var validationErr *password.ValidationError
+	if !errors.As(err, &validationErr) {
+		log.Printf("password check: %v", err)
+		w.WriteHeader(500)
+		w.Write([]byte("Failed to check password"))
+		return
+	}
+	response_json, _ := json.Marshal(violationsResponse{
+		Error:      "Password does not meet the requirements",
+		Violations: validationErr.Violations,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(400)
+	w.Write(response_json)
+}
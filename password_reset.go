@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/mailer"
+	"github.com/Lunnaris01/bootdev_servers/internal/password"
+)
+
+const passwordResetTTL = time.Hour
+
+// passwordResetWorkers bounds the reset mails being looked up and sent at
+// the same time.
+const passwordResetWorkers = 16
+
+// sendPasswordResetEmail issues a single use reset token for user and mails
+// it. Only the token's signature is stored.
+func (cfg *apiConfig) sendPasswordResetEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token, cfg.secretKey),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Send the token below together with a new password to POST /api/password/reset:\n\n%s\n\n"+
+			"The token expires in %v. If you did not ask for this, ignore this mail.\n",
+			token, passwordResetTTL),
+	})
+}
+
+func (cfg *apiConfig) forgotPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	type forgotBody struct {
+		Email string `json:"email"`
+	}
+
+	r_body := forgotBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil || r_body.Email == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("email is required"))
+		return
+	}
+
+	// Requests are counted per address and per client whether the account
+	// exists or not, so the limit tells nothing about the account.
+	email := accountKey(r_body.Email)
+	ip := clientIP(req)
+	accountWait, err := cfg.loginGuards.resetAccount.Wait(req.Context(), email)
+	if err != nil {
+		log.Printf("password reset: reading account counter: %v", err)
+	}
+	ipWait, err := cfg.loginGuards.resetIP.Wait(req.Context(), ip)
+	if err != nil {
+		log.Printf("password reset: reading IP counter: %v", err)
+	}
+	if wait := max(accountWait, ipWait); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(429)
+		w.Write([]byte("Too many password reset requests, try again later"))
+		return
+	}
+	_, err = cfg.loginGuards.resetAccount.Fail(req.Context(), email)
+	if err != nil {
+		log.Printf("password reset: counting account request: %v", err)
+	}
+	_, err = cfg.loginGuards.resetIP.Fail(req.Context(), ip)
+	if err != nil {
+		log.Printf("password reset: counting IP request: %v", err)
+	}
+
+	select {
+	case cfg.passwordResetSlots <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(503)
+		w.Write([]byte("Too many password reset requests, try again later"))
+		return
+	}
+	// The response must not tell whether the account exists, neither by
+	// status nor by timing, so the lookup and mail happen in the background.
+	go func() {
+		defer func() { <-cfg.passwordResetSlots }()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		user, err := cfg.dbQueries.GetUserByMail(ctx, r_body.Email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("password reset: looking up user: %v", err)
+			}
+			return
+		}
+		err = cfg.sendPasswordResetEmail(ctx, user)
+		if err != nil {
+			log.Printf("password reset: sending to user %s: %v", user.ID, err)
+		}
+	}()
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) resetPasswordHandler(w http.ResponseWriter, req *http.Request) {
+	type resetBody struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	r_body := resetBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil || r_body.Token == "" || r_body.Password == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("token and password are required"))
+		return
+	}
+	// The password is checked inside the transaction since the policy needs
+	// the account's email; a rejected password leaves the token unused.
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		userID, err := q.UsePasswordResetToken(req.Context(), auth.HashToken(r_body.Token, cfg.secretKey))
+		if err != nil {
+			return err
+		}
+		db_user, err := q.GetUserByID(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		err = cfg.passwordChecker.Validate(r_body.Password, db_user.Email)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := cfg.passwordHasher.Hash(r_body.Password)
+		if err != nil {
+			return err
+		}
+		err = q.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+			ID:             userID,
+			HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = q.InvalidatePasswordResetTokens(req.Context(), userID)
+		if err != nil {
+			return err
+		}
+		// Whoever knew the old password may still hold a session, an API
+		// key or a grant to a client of their own.
+		err = revokeAllAccess(req.Context(), q, userID)
+		if err != nil {
+			return err
+		}
+		return recordAudit(req.Context(), q, auditEntry{
+			Action:     auditPasswordChanged,
+			ActorID:    userID,
+			TargetType: auditTargetUser,
+			TargetID:   userID.String(),
+			Diff: map[string]any{
+				"password":         map[string]any{"changed": true},
+				"via":              "reset_token",
+				"sessions_revoked": true,
+				"api_keys_revoked": true,
+				"grants_revoked":   true,
+			},
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid or expired token"))
+		return
+	}
+	var validationErr *password.ValidationError
+	if errors.As(err, &validationErr) {
+		writePasswordError(w, err)
+		return
+	}
+	if errors.Is(err, auth.ErrPasswordTooLong) {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+var errLastAdmin = errors.New("Cannot remove the role of the last admin")
+
+// middlewareRequireRole guards /admin routes. The token needs the admin
+// scope, and the user's current role, read from the database so a demotion
+// takes effect at once, has to be one of roles.
+func (cfg *apiConfig) middlewareRequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return cfg.middlewareRequireScopes(func(w http.ResponseWriter, req *http.Request) {
+		claims, _ := cfg.authenticate(req)
+		db_user, err := cfg.dbQueries.GetUserByID(req.Context(), claims.UserID)
+		if err != nil {
+			w.WriteHeader(401)
+			w.Write([]byte("User not found"))
+			return
+		}
+		if !slices.Contains(roles, db_user.Role) {
+			w.WriteHeader(403)
+			w.Write([]byte("Requires role " + strings.Join(roles, " or ")))
+			return
+		}
+		next(w, req)
+	}, auth.ScopeAdmin)
+}
+
+// loadAdminEmails reads ADMIN_EMAILS, the comma separated addresses of
+// accounts that are made admins.
+func loadAdminEmails() map[string]bool {
+	emails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			emails[email] = true
+		}
+	}
+	return emails
+}
+
+// bootstrapAdmin makes db_user an admin if its email is listed in
+// ADMIN_EMAILS and returns it with its current role. Outside of dev the
+// address has to be verified first, so nobody can claim admin rights by
+// signing up with it.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context, db_user database.User) database.User {
+	if !cfg.adminEmails[strings.ToLower(db_user.Email)] || db_user.Role == auth.RoleAdmin {
+		return db_user
+	}
+	if !db_user.EmailVerifiedAt.Valid && cfg.platform != "dev" {
+		log.Printf("admin bootstrap: %s is not verified yet", db_user.Email)
+		return db_user
+	}
+	_, err := cfg.changeRole(ctx, db_user.ID, auth.RoleAdmin, uuid.Nil, "listed in ADMIN_EMAILS")
+	if err != nil {
+		log.Printf("admin bootstrap: promoting user %s: %v", db_user.ID, err)
+		return db_user
+	}
+	db_user.Role = auth.RoleAdmin
+	return db_user
+}
+
+// bootstrapAdmins promotes the existing accounts of ADMIN_EMAILS at startup.
+func (cfg *apiConfig) bootstrapAdmins(ctx context.Context) {
+	for email := range cfg.adminEmails {
+		db_user, err := cfg.dbQueries.GetUserByMail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("admin bootstrap: looking up %s: %v", email, err)
+			continue
+		}
+		cfg.bootstrapAdmin(ctx, db_user)
+	}
+}
+
+// changeRole sets the role of userID and records who changed it and why.
+// changedBy is uuid.Nil for changes made by the server.
+func (cfg *apiConfig) changeRole(ctx context.Context, userID uuid.UUID, role string, changedBy uuid.UUID, reason string) (database.RoleChange, error) {
+	var change database.RoleChange
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		// A demotion locks every admin before counting them, so two admins
+		// demoting each other at once cannot both count the other one.
+		var admins []uuid.UUID
+		var err error
+		if role != auth.RoleAdmin {
+			admins, err = q.LockUsersWithRole(ctx, auth.RoleAdmin)
+			if err != nil {
+				return err
+			}
+		}
+		oldRole, err := q.GetUserRoleForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if oldRole == auth.RoleAdmin && role != auth.RoleAdmin && len(admins) <= 1 {
+			return errLastAdmin
+		}
+		err = q.SetUserRole(ctx, database.SetUserRoleParams{ID: userID, Role: role})
+		if err != nil {
+			return err
+		}
+		change, err = q.CreateRoleChange(ctx, database.CreateRoleChangeParams{
+			OldRole:   oldRole,
+			NewRole:   role,
+			Reason:    reason,
+			UserID:    userID,
+			ChangedBy: uuid.NullUUID{UUID: changedBy, Valid: changedBy != uuid.Nil},
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, q, auditEntry{
+			Action:     auditRoleChanged,
+			ActorID:    changedBy,
+			TargetType: auditTargetUser,
+			TargetID:   userID.String(),
+			Diff: map[string]any{
+				"role":   auditChange(oldRole, role),
+				"reason": reason,
+			},
+		})
+	})
+	return change, err
+}
+
+type roleChangeResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	OldRole   string     `json:"old_role"`
+	NewRole   string     `json:"new_role"`
+	Reason    string     `json:"reason"`
+	ChangedBy *uuid.UUID `json:"changed_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func newRoleChangeResponse(change database.RoleChange) roleChangeResponse {
+	res := roleChangeResponse{
+		ID:        change.ID,
+		UserID:    change.UserID,
+		OldRole:   change.OldRole,
+		NewRole:   change.NewRole,
+		Reason:    change.Reason,
+		CreatedAt: change.CreatedAt,
+	}
+	if change.ChangedBy.Valid {
+		res.ChangedBy = &change.ChangedBy.UUID
+	}
+	return res
+}
+
+func (cfg *apiConfig) setUserRoleHandler(w http.ResponseWriter, req *http.Request) {
+	type roleBody struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+
+	r_body := roleBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !auth.ValidRole(r_body.Role) {
+		w.WriteHeader(400)
+		w.Write([]byte("Unknown role " + r_body.Role))
+		return
+	}
+	if strings.TrimSpace(r_body.Reason) == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("reason is required"))
+		return
+	}
+
+	change, err := cfg.changeRole(req.Context(), userID, r_body.Role, claims.UserID, r_body.Reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		w.Write([]byte("User not found"))
+		return
+	}
+	if errors.Is(err, errLastAdmin) {
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	response_json, _ := json.Marshal(newRoleChangeResponse(change))
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// listRoleChangesHandler returns the latest role changes, optionally only
+// those of ?user_id=.
+func (cfg *apiConfig) listRoleChangesHandler(w http.ResponseWriter, req *http.Request) {
+	limit := 100
+	if value := req.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			w.WriteHeader(400)
+			w.Write([]byte("limit must be between 1 and 1000"))
+			return
+		}
+		limit = parsed
+	}
+
+	var changes []database.RoleChange
+	var err error
+	if value := req.URL.Query().Get("user_id"); value != "" {
+		userID, parseErr := uuid.Parse(value)
+		if parseErr != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(parseErr.Error()))
+			return
+		}
+		changes, err = cfg.dbQueries.ListRoleChangesForUser(req.Context(), database.ListRoleChangesForUserParams{
+			UserID: userID,
+			Limit:  int32(limit),
+		})
+	} else {
+		changes, err = cfg.dbQueries.ListRoleChanges(req.Context(), int32(limit))
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_body := []roleChangeResponse{}
+	for _, change := range changes {
+		res_body = append(res_body, newRoleChangeResponse(change))
+	}
+	response_json, _ := json.Marshal(res_body)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// moderateChirpHandler lets moderators remove any chirp.
+func (cfg *apiConfig) moderateChirpHandler(w http.ResponseWriter, req *http.Request) {
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("Chirp not found"))
+		return
+	}
+	db_chirp, err := cfg.dbQueries.GetChirp(req.Context(), chirpID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte("Chirp not found"))
+		return
+	}
+
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		err := q.DeleteChirp(req.Context(), db_chirp.ID)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(req.Context(), q, auditEntry{
+			Action:     auditChirpModerated,
+			ActorID:    claims.UserID,
+			TargetType: auditTargetChirp,
+			TargetID:   db_chirp.ID.String(),
+			Diff:       auditChirpRemoval(db_chirp),
+		})
+		if err != nil {
+			return err
+		}
+		return recordEvent(req.Context(), q, events.ChirpDeleted, db_chirp.ID, newChirpEventPayload(db_chirp))
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestRequireRole(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	admin := createTestUser(t, cfg, auth.RoleAdmin)
+	moderator := createTestUser(t, cfg, auth.RoleModerator)
+	user := createTestUser(t, cfg, auth.RoleUser)
+
+	t.Run("admin passes", func(t *testing.T) {
+		rec := serve(mux, "GET", "/admin/audit-log", admin.token, "")
+		if rec.Code != 200 {
+			t.Errorf("Expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("user token lacks the admin scope", func(t *testing.T) {
+		rec := serve(mux, "GET", "/admin/audit-log", user.token, "")
+		if rec.Code != 403 {
+			t.Errorf("Expected 403, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("admin scope without the role", func(t *testing.T) {
+		// A token minted before its user was demoted still carries the
+		// admin scope; the role is read from the database.
+		token := signTestToken(t, cfg, user.ID, auth.ScopesForRole(auth.RoleAdmin))
+		rec := serve(mux, "GET", "/admin/audit-log", token, "")
+		if rec.Code != 403 {
+			t.Errorf("Expected 403, got %d: %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("moderator cannot change roles", func(t *testing.T) {
+		rec := serve(mux, "PUT", "/admin/users/"+user.ID.String()+"/role", moderator.token, `{"role":"admin","reason":"test"}`)
+		if rec.Code != 403 {
+			t.Errorf("Expected 403, got %d: %s", rec.Code, rec.Body)
+		}
+		db_user, err := cfg.dbQueries.GetUserByID(context.Background(), user.ID)
+		if err != nil {
+			t.Fatal("failed to get user:", err)
+		}
+		if db_user.Role != auth.RoleUser {
+			t.Errorf("Expected role to stay %s, got %s", auth.RoleUser, db_user.Role)
+		}
+	})
+}
+
+func TestLastAdminGuard(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	admin := createTestUser(t, cfg, auth.RoleAdmin)
+	path := "/admin/users/" + admin.ID.String() + "/role"
+
+	rec := serve(mux, "PUT", path, admin.token, `{"role":"user","reason":"stepping down"}`)
+	if rec.Code != 409 {
+		t.Fatalf("Expected the last admin to be kept, got %d: %s", rec.Code, rec.Body)
+	}
+
+	createTestUser(t, cfg, auth.RoleAdmin)
+	rec = serve(mux, "PUT", path, admin.token, `{"role":"user","reason":"stepping down"}`)
+	if rec.Code != 200 {
+		t.Errorf("Expected demotion with another admin left, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConcurrentDemotionsKeepAnAdmin(t *testing.T) {
+	cfg := newTestConfig(t)
+	first := createTestUser(t, cfg, auth.RoleAdmin)
+	second := createTestUser(t, cfg, auth.RoleAdmin)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, target := range []testUser{first, second} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = cfg.changeRole(context.Background(), target.ID, auth.RoleUser, uuid.Nil, "stepping down")
+		}()
+	}
+	wg.Wait()
+
+	refused := 0
+	for _, err := range errs {
+		if errors.Is(err, errLastAdmin) {
+			refused++
+		} else if err != nil {
+			t.Fatal("failed to change role:", err)
+		}
+	}
+	if refused != 1 {
+		t.Errorf("Expected exactly one demotion to be refused, got %d", refused)
+	}
+}
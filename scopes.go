@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+// mintedTokenMaxTTL caps the lifetime of tokens minted for bots; they cannot
+// be refreshed or revoked individually. They are not tied to the session they
+// were minted from either, so they must not outlive the access token of a
+// revoked session, which is valid for an hour.
+const mintedTokenMaxTTL = time.Hour
+
+type claimsContextKey struct{}
+
+// authenticate returns the claims of the request's bearer access token or,
+// for scripts, its personal API key. Routes behind middlewareRequireScopes
+// reuse the claims the middleware checked.
+func (cfg *apiConfig) authenticate(req *http.Request) (*auth.Claims, error) {
+	if claims, ok := req.Context().Value(claimsContextKey{}).(*auth.Claims); ok {
+		return claims, nil
+	}
+	var claims *auth.Claims
+	bearerToken, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		apiKey, keyErr := auth.GetAPIKey(req.Header)
+		if keyErr != nil {
+			return nil, err
+		}
+		claims, err = cfg.authenticateAPIKey(req.Context(), apiKey)
+	} else {
+		claims, err = cfg.jwtKeys.ValidateJWT(bearerToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Suspensions apply right away, not once tokens, minted tokens and API
+	// keys expire.
+	err = cfg.checkNotSuspended(req.Context(), claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// middlewareRequireScopes rejects requests whose access token is missing or
+// lacks one of scopes.
+func (cfg *apiConfig) middlewareRequireScopes(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		claims, err := cfg.authenticate(req)
+		if err != nil {
+			w.WriteHeader(401)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				w.WriteHeader(403)
+				w.Write([]byte("Token lacks the " + scope + " scope"))
+				return
+			}
+		}
+		next(w, req.WithContext(context.WithValue(req.Context(), claimsContextKey{}, claims)))
+	}
+}
+
+// mintTokenHandler issues an access token with a subset of the caller's
+// scopes, e.g. chirps:write only for a bot.
+func (cfg *apiConfig) mintTokenHandler(w http.ResponseWriter, req *http.Request) {
+	type mintBody struct {
+		Scopes           []string `json:"scopes"`
+		ExpiresInSeconds int      `json:"expires_in_seconds"`
+	}
+	type mintResponse struct {
+		Token     string    `json:"token"`
+		Scope     string    `json:"scope"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	// Minted tokens must not mint further tokens to extend their lifetime.
+	if claims.SessionID == uuid.Nil {
+		w.WriteHeader(403)
+		w.Write([]byte("Tokens can only be minted from a login session"))
+		return
+	}
+
+	r_body := mintBody{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(r_body.Scopes) == 0 {
+		w.WriteHeader(400)
+		w.Write([]byte("At least one scope is required"))
+		return
+	}
+	for _, scope := range r_body.Scopes {
+		if !auth.ValidScope(scope) {
+			w.WriteHeader(400)
+			w.Write([]byte("Unknown scope " + scope))
+			return
+		}
+		if !claims.HasScope(scope) {
+			w.WriteHeader(403)
+			w.Write([]byte("Cannot grant the " + scope + " scope"))
+			return
+		}
+	}
+	expiresIn := time.Hour
+	if r_body.ExpiresInSeconds > 0 {
+		expiresIn = time.Duration(r_body.ExpiresInSeconds) * time.Second
+	}
+	if expiresIn > mintedTokenMaxTTL {
+		expiresIn = mintedTokenMaxTTL
+	}
+
+	minted := auth.NewClaims(claims.UserID, uuid.Nil, r_body.Scopes, expiresIn)
+	token, err := cfg.jwtKeys.Sign(minted)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	response_json, _ := json.Marshal(mintResponse{
+		Token:     token,
+		Scope:     strings.Join(r_body.Scopes, " "),
+		ExpiresAt: minted.ExpiresAt.Time,
+	})
+	w.WriteHeader(201)
+	w.Write(response_json)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestMintedTokenLifetimeCapped(t *testing.T) {
+	cfg := newTestConfig(t)
+	user := createTestUser(t, cfg, auth.RoleUser)
+	sessionToken, err := cfg.jwtKeys.Sign(auth.NewClaims(user.ID, uuid.New(), auth.ScopesForRole(auth.RoleUser), time.Hour))
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+
+	body := `{"scopes":["chirps:write"],"expires_in_seconds":86400}`
+	rec := serve(http.HandlerFunc(cfg.mintTokenHandler), "POST", "/api/tokens", sessionToken, body)
+	if rec.Code != 201 {
+		t.Fatalf("Expected minting to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	minted := struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	err = json.Unmarshal(rec.Body.Bytes(), &minted)
+	if err != nil {
+		t.Fatal("failed to decode response:", err)
+	}
+	if minted.ExpiresAt.After(time.Now().Add(mintedTokenMaxTTL + time.Minute)) {
+		t.Errorf("Expected the lifetime to be capped at %v, token expires at %v", mintedTokenMaxTTL, minted.ExpiresAt)
+	}
+
+	rec = serve(http.HandlerFunc(cfg.mintTokenHandler), "POST", "/api/tokens", signTestToken(t, cfg, user.ID, []string{auth.ScopeChirpsWrite}), body)
+	if rec.Code != 403 {
+		t.Errorf("Expected a token without session to be refused, got %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+const securityEventRefreshTokenReuse = "refresh_token.reuse"
+
+// recordSecurityEvent stores a security relevant incident for later review
+// and mirrors it to the server log.
+func recordSecurityEvent(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, details map[string]any) error {
+	log.Printf("security event %s for user %s: %v", eventType, userID, details)
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	return q.CreateSecurityEvent(ctx, database.CreateSecurityEventParams{
+		EventType: eventType,
+		Details:   data,
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+	})
+}
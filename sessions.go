@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/google/uuid"
+)
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// revokeAllAccess ends every way userID has into the account other than the
+// password: sessions, API keys and the grants of OAuth clients. q must
+// belong to the transaction that changes the account.
+func revokeAllAccess(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	err := q.RevokeAllRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = q.RevokeAllAPIKeysForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = q.RevokeAllOAuthGrantsForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return q.InvalidateOAuthCodesForUser(ctx, userID)
+}
+
+func (cfg *apiConfig) listSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	type Session struct {
+		ID         uuid.UUID `json:"id"`
+		UserAgent  string    `json:"user_agent"`
+		IPAddress  string    `json:"ip_address"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		Current    bool      `json:"current"`
+	}
+
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	dbSessions, err := cfg.dbQueries.ListSessions(req.Context(), claims.UserID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	sessions := []Session{}
+	for _, dbSession := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         dbSession.FamilyID,
+			UserAgent:  dbSession.UserAgent,
+			IPAddress:  dbSession.IpAddress,
+			CreatedAt:  dbSession.CreatedAt,
+			LastUsedAt: dbSession.LastUsedAt,
+			ExpiresAt:  dbSession.ExpiresAt,
+			Current:    dbSession.FamilyID == claims.SessionID,
+		})
+	}
+	response_json, _ := json.Marshal(sessions)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// revokeSessionHandler logs a device out. Its access tokens stay valid until
+// they expire, refreshing fails immediately.
+func (cfg *apiConfig) revokeSessionHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("Invalid session ID"))
+		return
+	}
+	revoked, err := cfg.dbQueries.RevokeSession(req.Context(), database.RevokeSessionParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if revoked == 0 {
+		w.WriteHeader(404)
+		w.Write([]byte("Session not found"))
+		return
+	}
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action:     auditSessionRevoked,
+		ActorID:    userID,
+		TargetType: auditTargetSession,
+		TargetID:   sessionID.String(),
+	})
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) revokeOtherSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	claims, err := cfg.authenticate(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	revoked, err := cfg.dbQueries.RevokeOtherSessions(req.Context(), database.RevokeOtherSessionsParams{
+		UserID:   claims.UserID,
+		FamilyID: claims.SessionID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	cfg.recordAuditBestEffort(req.Context(), auditOtherSessionsRevoked(claims.UserID, claims.SessionID, revoked))
+	w.WriteHeader(204)
+}
@@ -0,0 +1,32 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, name, key_prefix, key_hash, scopes, created_at, expires_at, last_used_at, revoked_at, user_id)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW(),
+	$5,
+	NULL,
+	NULL,
+	$6
+)
+RETURNING *;
+
+-- name: GetActiveAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllAPIKeysForUser :exec
+UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
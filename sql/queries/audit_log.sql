@@ -0,0 +1,15 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (action, actor_id, target_type, target_id, ip_address, user_agent, request_id, diff)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+	AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+	AND (sqlc.narg(target_type)::text IS NULL OR target_type = sqlc.narg(target_type))
+	AND (sqlc.narg(target_id)::text IS NULL OR target_id = sqlc.narg(target_id))
+	AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+	AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+	AND (sqlc.narg(before)::bigint IS NULL OR id < sqlc.narg(before))
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit);
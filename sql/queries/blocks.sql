@@ -0,0 +1,26 @@
+-- name: CreateBlock :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBlock :execrows
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: ListBlocks :many
+SELECT * FROM blocks WHERE blocker_id = $1 ORDER BY created_at DESC;
+
+-- name: IsBlocked :one
+SELECT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = sqlc.arg(other_id))
+	OR (blocker_id = sqlc.arg(other_id) AND blocked_id = sqlc.arg(user_id))
+);
+
+-- name: ListBlockedEitherWayIDs :many
+SELECT blocked_id AS user_id FROM blocks WHERE blocker_id = sqlc.arg(user_id)
+UNION
+SELECT blocker_id AS user_id FROM blocks WHERE blocked_id = sqlc.arg(user_id);
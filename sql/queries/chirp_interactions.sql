@@ -0,0 +1,23 @@
+-- name: CreateChirpLike :execrows
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpLike :execrows
+DELETE FROM chirp_likes WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: CreateRechirp :execrows
+INSERT INTO rechirps (chirp_id, user_id, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM rechirps WHERE chirp_id = $1 AND user_id = $2;
@@ -1,22 +1,33 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
 -- name: GetChirp :one
 SELECT * FROM chirps WHERE id = $1;
 
+-- name: GetVisibleChirp :one
+SELECT * FROM chirps WHERE id = sqlc.arg(id) AND can_view_chirps_of(user_id, sqlc.arg(viewer_id));
+
 -- name: GetAllChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC;
+SELECT * FROM chirps
+WHERE can_view_chirps_of(user_id, sqlc.arg(viewer_id))
+	AND NOT EXISTS (
+		SELECT 1 FROM mutes WHERE mutes.muter_id = sqlc.arg(viewer_id) AND mutes.muted_id = chirps.user_id
+	)
+ORDER BY created_at ASC;
 
 -- name: GetAllChirpsForAuthor :many
-SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at ASC;
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND can_view_chirps_of(user_id, sqlc.arg(viewer_id))
+ORDER BY created_at ASC;
 
 
 -- name: DeleteChirp :exec
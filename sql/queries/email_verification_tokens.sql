@@ -0,0 +1,18 @@
+-- name: CreateEmailVerificationToken :exec
+INSERT INTO email_verification_tokens (token_hash, email, created_at, expires_at, used_at, user_id)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3,
+	NULL,
+	$4
+);
+
+-- name: UseEmailVerificationToken :one
+UPDATE email_verification_tokens SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
@@ -0,0 +1,33 @@
+-- name: CreateFollow :execrows
+INSERT INTO follows (follower_id, followee_id, created_at, status)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteFollow :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFolloweeIDs :many
+SELECT followee_id FROM follows WHERE follower_id = $1 AND status = 'approved';
+
+-- name: ListFollowRequests :many
+SELECT * FROM follows WHERE followee_id = $1 AND status = 'pending' ORDER BY created_at ASC;
+
+-- name: ApproveFollowRequest :execrows
+UPDATE follows SET status = 'approved'
+WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: DenyFollowRequest :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2 AND status = 'pending';
+
+-- name: ApproveAllFollowRequests :many
+UPDATE follows SET status = 'approved'
+WHERE followee_id = $1 AND status = 'pending'
+RETURNING follower_id;
+
+-- name: CanViewChirpsOf :one
+SELECT can_view_chirps_of(sqlc.arg(author_id), sqlc.arg(viewer_id));
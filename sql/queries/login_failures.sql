@@ -0,0 +1,26 @@
+-- name: GetLoginFailures :one
+SELECT * FROM login_failures WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (key, failures, last_failure_at, locked_until)
+VALUES (sqlc.arg(key), 1, sqlc.arg(now), NULL)
+ON CONFLICT (key) DO UPDATE SET
+	failures = CASE
+		WHEN login_failures.last_failure_at <= sqlc.arg(window_start) THEN 1
+		ELSE login_failures.failures + 1
+	END,
+	last_failure_at = sqlc.arg(now)
+RETURNING *;
+
+-- name: LockLoginFailures :exec
+UPDATE login_failures SET locked_until = $2 WHERE key = $1;
+
+-- name: ResetLoginFailures :exec
+DELETE FROM login_failures WHERE key = $1;
+
+-- name: DeleteStaleLoginFailures :execrows
+DELETE FROM login_failures
+WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
+
+-- name: DeleteAllLoginFailures :exec
+DELETE FROM login_failures;
@@ -0,0 +1,23 @@
+-- name: SuspendUser :one
+UPDATE users SET
+	suspended_at = NOW(),
+	suspended_until = $2,
+	suspension_reason = $3,
+	updated_at = NOW()
+WHERE id = $1 RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users SET
+	suspended_at = NULL,
+	suspended_until = NULL,
+	suspension_reason = '',
+	updated_at = NOW()
+WHERE id = $1 RETURNING *;
+
+-- name: ShadowBanUser :one
+UPDATE users SET shadow_banned_at = COALESCE(shadow_banned_at, NOW()), updated_at = NOW()
+WHERE id = $1 RETURNING *;
+
+-- name: LiftShadowBan :one
+UPDATE users SET shadow_banned_at = NULL, updated_at = NOW()
+WHERE id = $1 RETURNING *;
@@ -0,0 +1,41 @@
+-- name: UpsertNotification :one
+INSERT INTO notifications (type, group_key, actor_ids, subject_id, created_at, updated_at, user_id)
+VALUES (
+	sqlc.arg(type),
+	sqlc.arg(group_key),
+	ARRAY[sqlc.arg(actor_id)::uuid],
+	sqlc.narg(subject_id),
+	NOW(),
+	NOW(),
+	sqlc.arg(user_id)
+)
+ON CONFLICT (user_id, group_key) WHERE read_at IS NULL DO UPDATE SET
+	seq = nextval('notifications_seq'),
+	actor_ids = CASE
+		WHEN EXCLUDED.actor_ids[1] = ANY(notifications.actor_ids) THEN notifications.actor_ids
+		ELSE array_append(notifications.actor_ids, EXCLUDED.actor_ids[1])
+	END,
+	updated_at = NOW()
+RETURNING *;
+
+-- name: ListNotifications :many
+SELECT * FROM notifications WHERE user_id = $1 AND seq < $2 ORDER BY seq DESC LIMIT $3;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsReadUpTo :execrows
+UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND seq <= $2 AND read_at IS NULL;
+
+-- name: GetNotificationPreferences :many
+SELECT * FROM notification_preferences WHERE user_id = $1;
+
+-- name: UpsertNotificationPreference :exec
+INSERT INTO notification_preferences (type, enabled, updated_at, user_id)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	$3
+)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = NOW();
@@ -0,0 +1,78 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, scopes, created_at, user_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	NOW(),
+	$6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND user_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, grant_id, redirect_uri, scopes, code_challenge, nonce, auth_time, expires_at, used_at, client_id, user_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6,
+	$7,
+	$8,
+	NULL,
+	$9,
+	$10
+);
+
+-- name: GetOAuthCode :one
+SELECT * FROM oauth_authorization_codes WHERE code_hash = $1;
+
+-- name: UseOAuthCode :execrows
+UPDATE oauth_authorization_codes SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL;
+
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (token_hash, grant_id, scopes, auth_time, created_at, expires_at, used_at, revoked_at, client_id, user_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	NOW(),
+	$5,
+	NULL,
+	NULL,
+	$6,
+	$7
+);
+
+-- name: GetOAuthRefreshToken :one
+SELECT * FROM oauth_refresh_tokens WHERE token_hash = $1;
+
+-- name: UseOAuthRefreshToken :execrows
+UPDATE oauth_refresh_tokens SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
+
+-- name: RevokeOAuthGrant :exec
+UPDATE oauth_refresh_tokens SET revoked_at = NOW()
+WHERE grant_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthGrantsForUser :exec
+UPDATE oauth_refresh_tokens SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: InvalidateOAuthCodesForUser :exec
+UPDATE oauth_authorization_codes SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,31 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox (id, event_type, aggregate_id, payload, occurred_at)
+VALUES (
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+);
+
+-- name: ClaimDueOutboxEvents :many
+WITH due AS (
+	SELECT id FROM outbox
+	WHERE dispatched_at IS NULL AND next_attempt_at <= sqlc.arg(now) AND attempts < sqlc.arg(max_attempts)
+	ORDER BY occurred_at ASC
+	LIMIT sqlc.arg(batch_size)
+	FOR UPDATE SKIP LOCKED
+)
+UPDATE outbox SET next_attempt_at = sqlc.arg(locked_until)
+FROM due
+WHERE outbox.id = due.id
+RETURNING outbox.id, outbox.event_type, outbox.aggregate_id, outbox.payload, outbox.occurred_at, outbox.attempts, outbox.handled_by;
+
+-- name: MarkOutboxEventDispatched :exec
+UPDATE outbox SET dispatched_at = NOW(), last_error = NULL WHERE id = $1;
+
+-- name: MarkOutboxEventFailed :exec
+UPDATE outbox SET attempts = attempts + 1, last_error = $2, handled_by = $3, next_attempt_at = $4 WHERE id = $1;
+
+-- name: DeleteAllOutboxEvents :exec
+DELETE FROM outbox;
@@ -0,0 +1,17 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, created_at, expires_at, used_at, user_id)
+VALUES (
+	$1,
+	NOW(),
+	$2,
+	NULL,
+	$3
+);
+
+-- name: UsePasswordResetToken :one
+UPDATE password_reset_tokens SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,17 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, used_at, user_id)
+VALUES (
+	$1,
+	NOW(),
+	NULL,
+	$2
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL;
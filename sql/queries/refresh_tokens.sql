@@ -1,18 +1,55 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, expires_at, revoked_at, user_id)
+INSERT INTO refresh_tokens (id, token_hash, token_prefix, created_at, updated_at, expires_at, revoked_at, user_id, family_id, user_agent, ip_address, last_used_at)
 VALUES (
+	gen_random_uuid(),
 	$1,
+	$2,
 	NOW(),
 	NOW(),
-	$2,
+	$3,
     NULL,
-    $3
+    $4,
+    $5,
+    $6,
+    $7,
+    NOW()
 )
 RETURNING *;
 
--- name: RevokeTokenAccess :exec
-UPDATE refresh_tokens SET expires_at = $2 WHERE token = $1;
+-- name: GetRefreshTokenForUpdate :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE;
+
+-- name: MarkRefreshTokenRotated :exec
+UPDATE refresh_tokens SET rotated_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeTokenAccess :one
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING user_id, family_id;
 
 
 -- name: DeleteAllRefreshTokens :exec
 DELETE FROM refresh_tokens;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT
+	r.family_id,
+	r.user_agent,
+	r.ip_address,
+	r.last_used_at,
+	r.expires_at,
+	(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = r.family_id)::timestamp AS created_at
+FROM refresh_tokens r
+WHERE r.user_id = $1 AND r.rotated_at IS NULL AND r.revoked_at IS NULL AND r.expires_at > NOW()
+ORDER BY r.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(), updated_at = NOW() WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL;
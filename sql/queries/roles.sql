@@ -0,0 +1,27 @@
+-- name: GetUserRoleForUpdate :one
+SELECT role FROM users WHERE id = $1 FOR UPDATE;
+
+-- name: SetUserRole :exec
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: LockUsersWithRole :many
+SELECT id FROM users WHERE role = $1 ORDER BY id FOR UPDATE;
+
+-- name: CreateRoleChange :one
+INSERT INTO role_changes (id, old_role, new_role, reason, created_at, user_id, changed_by)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	NOW(),
+	$4,
+	$5
+)
+RETURNING *;
+
+-- name: ListRoleChanges :many
+SELECT * FROM role_changes ORDER BY created_at DESC LIMIT $1;
+
+-- name: ListRoleChangesForUser :many
+SELECT * FROM role_changes WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2;
@@ -0,0 +1,12 @@
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (id, event_type, details, created_at, user_id)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	NOW(),
+	$3
+);
+
+-- name: DeleteAllSecurityEvents :exec
+DELETE FROM security_events;
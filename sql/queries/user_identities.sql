@@ -0,0 +1,28 @@
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (provider, subject, email, created_at, last_login_at, user_id)
+VALUES (
+	$1,
+	$2,
+	$3,
+	NOW(),
+	NULL,
+	$4
+)
+ON CONFLICT DO NOTHING
+RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities WHERE provider = $1 AND subject = $2;
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities SET email = $3, last_login_at = NOW()
+WHERE provider = $1 AND subject = $2;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities WHERE user_id = $1 ORDER BY created_at;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities WHERE user_id = $1 AND provider = $2;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM user_identities WHERE user_id = $1;
@@ -9,17 +9,62 @@ VALUES (
 )
 RETURNING *;
 
+-- name: CreatePasswordlessUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, email_verified_at)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	NULL,
+	$2
+)
+RETURNING *;
+
 -- name: GetUserByMail :one
 SELECT * FROM users WHERE email = $1;
 
 -- name: GetUserFromRefreshToken :one
-SELECT u.id FROM users u INNER JOIN refresh_tokens r ON u.id = r.user_id WHERE r.token = $1 AND r.expires_at > NOW() AND r.revoked_at IS NULL;
+SELECT u.id FROM users u INNER JOIN refresh_tokens r ON u.id = r.user_id WHERE r.token_hash = $1 AND r.expires_at > NOW() AND r.revoked_at IS NULL;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
 
 -- name: UpdateUserPassAndMailByID :one
-UPDATE users SET email=$2, hashed_password = $3, updated_at = NOW() WHERE id = $1 RETURNING *; 
+UPDATE users SET
+	email = $2,
+	hashed_password = $3,
+	email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+	updated_at = NOW()
+WHERE id = $1 RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: SetUserTOTPSecret :execrows
+UPDATE users SET totp_secret = $2, updated_at = NOW() WHERE id = $1 AND totp_enabled_at IS NULL;
+
+-- name: EnableUserTOTP :execrows
+UPDATE users SET totp_enabled_at = NOW(), updated_at = NOW() WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2;
 
 -- name: SubscribeUser :exec
 UPDATE users SET is_chirpy_red = true WHERE id = $1;
 
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
+
+-- name: UpgradeUserPasswordHash :execrows
+UPDATE users SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hash);
+
+-- name: SetUserPrivate :exec
+UPDATE users SET is_private = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: SetUserHandle :one
+UPDATE users SET handle = $2, updated_at = NOW() WHERE id = $1 RETURNING *;
+
+-- name: GetUsersByHandles :many
+SELECT * FROM users WHERE handle = ANY(sqlc.arg(handles)::TEXT[]);
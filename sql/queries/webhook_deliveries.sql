@@ -0,0 +1,52 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, event_id, event_type, payload, status, attempts, next_attempt_at, endpoint_id)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	'pending',
+	0,
+	NOW(),
+	$4
+)
+ON CONFLICT (event_id, endpoint_id) DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+WITH due AS (
+	SELECT d.id FROM webhook_deliveries d INNER JOIN webhook_endpoints e ON e.id = d.endpoint_id
+	WHERE d.status = 'pending' AND d.next_attempt_at <= sqlc.arg(now) AND e.disabled_at IS NULL
+	ORDER BY d.next_attempt_at ASC
+	LIMIT sqlc.arg(batch_size)
+	FOR UPDATE OF d SKIP LOCKED
+)
+UPDATE webhook_deliveries d SET next_attempt_at = sqlc.arg(locked_until), updated_at = NOW()
+FROM due, webhook_endpoints e
+WHERE d.id = due.id AND e.id = d.endpoint_id
+RETURNING d.id, d.endpoint_id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: ListWebhookDeliveriesForEndpoint :many
+SELECT * FROM webhook_deliveries WHERE endpoint_id = $1 ORDER BY created_at DESC LIMIT $2;
+
+-- name: MarkWebhookDeliveryDelivered :exec
+UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, delivered_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: ScheduleWebhookDeliveryRetry :exec
+UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries SET status = 'failed', attempts = attempts + 1, updated_at = NOW() WHERE id = $1;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (id, attempt, attempted_at, status_code, error, duration_ms, delivery_id)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5,
+	$6
+);
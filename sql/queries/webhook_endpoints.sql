@@ -0,0 +1,34 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, url, secret, event_types, client_id, user_id)
+VALUES (
+	gen_random_uuid(),
+	NOW(),
+	NOW(),
+	$1,
+	$2,
+	$3,
+	$4,
+	$5
+)
+RETURNING *;
+
+-- name: ListWebhookEndpointsForUser :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: ListActiveWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints WHERE disabled_at IS NULL AND client_id IS NOT NULL AND sqlc.arg(event_type)::text = ANY(event_types);
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :execrows
+UPDATE webhook_endpoints SET disabled_at = NULL, failure_count = 0, updated_at = NOW() WHERE id = $1 AND user_id = $2 AND client_id IS NOT NULL;
+
+-- name: DisableWebhookEndpoint :exec
+UPDATE webhook_endpoints SET disabled_at = NOW(), updated_at = NOW() WHERE id = $1;
+
+-- name: IncrementWebhookEndpointFailures :one
+UPDATE webhook_endpoints SET failure_count = failure_count + 1, updated_at = NOW() WHERE id = $1 RETURNING failure_count;
+
+-- name: ResetWebhookEndpointFailures :exec
+UPDATE webhook_endpoints SET failure_count = 0, updated_at = NOW() WHERE id = $1 AND failure_count > 0;
@@ -0,0 +1,35 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, event_type, payload, received_at, status, locked_until)
+VALUES (
+	$1,
+	$2,
+	$3,
+	NOW(),
+	'pending',
+	$4
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: ClaimWebhookEvent :one
+UPDATE webhook_events SET status = 'pending', locked_until = $2
+WHERE id = $1 AND status IN ('pending', 'failed') AND locked_until < NOW()
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events ORDER BY received_at DESC LIMIT $1;
+
+-- name: ListWebhookEventsByStatus :many
+SELECT * FROM webhook_events WHERE status = $1 ORDER BY received_at DESC LIMIT $2;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events SET status = $2, error = NULL, processed_at = NOW(), locked_until = NOW() WHERE id = $1;
+
+-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_events SET status = 'failed', error = $2, processed_at = NOW(), locked_until = NOW() WHERE id = $1;
+
+-- name: DeleteAllWebhookEvents :exec
+DELETE FROM webhook_events;
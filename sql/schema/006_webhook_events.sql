@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+	id TEXT PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	received_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	error TEXT,
+	processed_at TIMESTAMP
+	);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
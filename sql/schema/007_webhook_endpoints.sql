@@ -0,0 +1,52 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	event_types TEXT[] NOT NULL,
+	failure_count INTEGER NOT NULL DEFAULT 0,
+	disabled_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+CREATE TABLE webhook_deliveries(
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	event_id UUID NOT NULL,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	delivered_at TIMESTAMP,
+    endpoint_id UUID NOT NULL,
+    FOREIGN KEY(endpoint_id)
+    REFERENCES webhook_endpoints(id)
+    ON DELETE CASCADE
+	);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE webhook_delivery_attempts(
+	id UUID PRIMARY KEY,
+	attempt INTEGER NOT NULL,
+	attempted_at TIMESTAMP NOT NULL,
+	status_code INTEGER,
+	error TEXT,
+	duration_ms INTEGER NOT NULL,
+    delivery_id UUID NOT NULL,
+    FOREIGN KEY(delivery_id)
+    REFERENCES webhook_deliveries(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE webhook_delivery_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE outbox(
+	id UUID PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	aggregate_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	occurred_at TIMESTAMP NOT NULL,
+	dispatched_at TIMESTAMP,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+	);
+
+CREATE INDEX outbox_pending_idx ON outbox(occurred_at) WHERE dispatched_at IS NULL;
+
+-- The relay delivers events at least once, so webhook deliveries are made
+-- idempotent per event and endpoint.
+CREATE UNIQUE INDEX webhook_deliveries_event_endpoint_idx ON webhook_deliveries(event_id, endpoint_id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_event_endpoint_idx;
+DROP TABLE outbox;
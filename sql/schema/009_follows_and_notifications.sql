@@ -0,0 +1,50 @@
+-- +goose Up
+CREATE TABLE follows(
+	follower_id UUID NOT NULL,
+	followee_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY(follower_id, followee_id),
+    FOREIGN KEY(follower_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    FOREIGN KEY(followee_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+CREATE INDEX follows_followee_idx ON follows(followee_id);
+
+CREATE TABLE notifications(
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	group_key TEXT NOT NULL,
+	actor_ids UUID[] NOT NULL,
+	subject_id UUID,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	read_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- Repeated events are folded into the single unread notification of their
+-- group, e.g. every like of the same chirp.
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications(user_id, group_key) WHERE read_at IS NULL;
+
+CREATE TABLE notification_preferences(
+	type TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+	PRIMARY KEY(user_id, type),
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
+DROP TABLE follows;
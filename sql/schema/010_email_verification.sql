@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+-- Accounts from before verification existed count as verified, otherwise
+-- REQUIRE_EMAIL_VERIFICATION would lock all of them out.
+UPDATE users SET email_verified_at = NOW();
+
+CREATE TABLE email_verification_tokens(
+	token_hash TEXT PRIMARY KEY,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens(
+	token_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;
+-- Highest TOTP time step accepted so far, codes at or below it are replays.
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes(
+	code_hash TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_step;
+ALTER TABLE users DROP COLUMN totp_enabled_at;
+ALTER TABLE users DROP COLUMN totp_secret;
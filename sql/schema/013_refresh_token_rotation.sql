@@ -0,0 +1,25 @@
+-- +goose Up
+-- Every login starts a token family; refreshing replaces the presented token
+-- with a new one from the same family.
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at TIMESTAMP;
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+
+CREATE TABLE security_events(
+	id UUID PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	details JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+    user_id UUID,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE security_events;
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN rotated_at;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Refresh tokens are only stored as SHA-256 hashes. The prefix is kept in
+-- the clear so a token can be recognised in listings without revealing it.
+ALTER TABLE refresh_tokens ADD COLUMN id UUID;
+ALTER TABLE refresh_tokens ADD COLUMN token_hash TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN token_prefix TEXT;
+UPDATE refresh_tokens SET
+	id = gen_random_uuid(),
+	token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+	token_prefix = left(token, 8);
+ALTER TABLE refresh_tokens ALTER COLUMN id SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN token_prefix SET NOT NULL;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ADD PRIMARY KEY (id);
+CREATE UNIQUE INDEX refresh_tokens_token_hash_idx ON refresh_tokens(token_hash);
+
+-- +goose Down
+-- Raw tokens cannot be recovered, everyone has to log in again.
+DELETE FROM refresh_tokens;
+DROP INDEX refresh_tokens_token_hash_idx;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens ADD COLUMN token TEXT PRIMARY KEY;
+ALTER TABLE refresh_tokens DROP COLUMN token_prefix;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+ALTER TABLE refresh_tokens DROP COLUMN id;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- A session is a refresh token family; the family's current token carries
+-- the client details of its latest use.
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens(user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN last_used_at;
+ALTER TABLE refresh_tokens DROP COLUMN ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
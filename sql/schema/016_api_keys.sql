@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE api_keys(
+	id UUID PRIMARY KEY,
+	name TEXT NOT NULL,
+	key_prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+CREATE INDEX api_keys_user_id_idx ON api_keys(user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,54 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+	id TEXT PRIMARY KEY,
+	-- NULL for public clients.
+	secret_hash TEXT,
+	name TEXT NOT NULL,
+	redirect_uris TEXT[] NOT NULL,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+CREATE INDEX oauth_clients_user_id_idx ON oauth_clients(user_id);
+
+CREATE TABLE oauth_authorization_codes(
+	code_hash TEXT PRIMARY KEY,
+	grant_id UUID NOT NULL,
+	redirect_uri TEXT NOT NULL,
+	scopes TEXT[] NOT NULL,
+	code_challenge TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	auth_time TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+CREATE TABLE oauth_refresh_tokens(
+	token_hash TEXT PRIMARY KEY,
+	grant_id UUID NOT NULL,
+	scopes TEXT[] NOT NULL,
+	auth_time TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+CREATE INDEX oauth_refresh_tokens_grant_id_idx ON oauth_refresh_tokens(grant_id);
+
+-- +goose Down
+DROP TABLE oauth_refresh_tokens;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
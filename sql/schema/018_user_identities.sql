@@ -0,0 +1,25 @@
+-- +goose Up
+-- Users signing up with an identity provider have no password.
+ALTER TABLE users ALTER COLUMN hashed_password DROP NOT NULL;
+ALTER TABLE users ALTER COLUMN hashed_password DROP DEFAULT;
+UPDATE users SET hashed_password = NULL WHERE hashed_password = 'unset';
+
+CREATE TABLE user_identities(
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	last_login_at TIMESTAMP,
+    user_id UUID NOT NULL,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+	PRIMARY KEY(provider, subject),
+	UNIQUE(user_id, provider)
+	);
+
+-- +goose Down
+DROP TABLE user_identities;
+UPDATE users SET hashed_password = 'unset' WHERE hashed_password IS NULL;
+ALTER TABLE users ALTER COLUMN hashed_password SET DEFAULT 'unset';
+ALTER TABLE users ALTER COLUMN hashed_password SET NOT NULL;
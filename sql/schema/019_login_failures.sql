@@ -0,0 +1,12 @@
+-- +goose Up
+-- key is prefixed by its kind, e.g. "account:walt@breakingbad.com" or
+-- "ip:203.0.113.7".
+CREATE TABLE login_failures(
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP
+	);
+
+-- +goose Down
+DROP TABLE login_failures;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+	CHECK (role IN ('user', 'moderator', 'admin'));
+
+-- role_changes is the audit trail of roles. It outlives the users it
+-- mentions, so there are no foreign keys. changed_by is NULL for changes made
+-- by the server itself, e.g. the ADMIN_EMAILS bootstrap.
+CREATE TABLE role_changes(
+	id UUID PRIMARY KEY,
+	old_role TEXT NOT NULL,
+	new_role TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	user_id UUID NOT NULL,
+	changed_by UUID
+	);
+
+CREATE INDEX role_changes_user_id_idx ON role_changes(user_id, created_at);
+
+-- +goose Down
+DROP TABLE role_changes;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,40 @@
+-- +goose Up
+-- audit_log answers who did what to which account. Rows are never changed
+-- or removed, which the trigger below enforces; like role_changes it has no
+-- foreign keys so entries outlive the users they mention.
+CREATE TABLE audit_log(
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	action TEXT NOT NULL,
+	actor_id UUID,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	ip_address TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	diff JSONB NOT NULL
+	);
+
+CREATE INDEX audit_log_actor_idx ON audit_log(actor_id, id);
+CREATE INDEX audit_log_target_idx ON audit_log(target_type, target_id, id);
+CREATE INDEX audit_log_action_idx ON audit_log(action, id);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_no_update_delete
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- +goose Down
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
@@ -0,0 +1,14 @@
+-- +goose Up
+-- A user is suspended from suspended_at until suspended_until, or for good
+-- when suspended_until is NULL. Both are NULL when the user is not suspended.
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+-- The chirps of a shadow-banned user are only shown to the user.
+ALTER TABLE users ADD COLUMN shadow_banned_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN shadow_banned_at;
+ALTER TABLE users DROP COLUMN suspension_reason;
+ALTER TABLE users DROP COLUMN suspended_until;
+ALTER TABLE users DROP COLUMN suspended_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Following a private user only requests to follow; the chirps of private
+-- users are shown to approved followers only.
+ALTER TABLE users ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE follows ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+	CHECK (status IN ('pending', 'approved'));
+
+CREATE INDEX follows_pending_idx ON follows(followee_id, created_at) WHERE status = 'pending';
+
+-- +goose Down
+DROP INDEX follows_pending_idx;
+ALTER TABLE follows DROP COLUMN status;
+ALTER TABLE users DROP COLUMN is_private;
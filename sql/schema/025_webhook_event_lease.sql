@@ -0,0 +1,9 @@
+-- +goose Up
+-- A pending event is being processed until locked_until. After that the
+-- process handling it is assumed to have died, and a Polka retry or a replay
+-- may claim it again. Finished events release the lease, so a failed event
+-- can be claimed again right away, but only by one request at a time.
+ALTER TABLE webhook_events ADD COLUMN locked_until TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- +goose Down
+ALTER TABLE webhook_events DROP COLUMN locked_until;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- The sinks that already handled an event, so a retry after one sink failed
+-- does not run the others again.
+ALTER TABLE outbox ADD COLUMN handled_by TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE outbox DROP COLUMN handled_by;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Notifications are ordered by seq, which moves a notification to the top
+-- whenever another event is folded into it. The id stays the same.
+CREATE SEQUENCE notifications_seq;
+ALTER TABLE notifications ADD COLUMN seq BIGINT;
+UPDATE notifications SET seq = id;
+SELECT setval('notifications_seq', (SELECT last_value FROM notifications_id_seq));
+ALTER TABLE notifications
+	ALTER COLUMN seq SET DEFAULT nextval('notifications_seq'),
+	ALTER COLUMN seq SET NOT NULL;
+CREATE INDEX notifications_user_seq_idx ON notifications(user_id, seq);
+
+-- +goose Down
+DROP INDEX notifications_user_seq_idx;
+ALTER TABLE notifications DROP COLUMN seq;
+DROP SEQUENCE notifications_seq;
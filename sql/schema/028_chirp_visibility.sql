@@ -0,0 +1,30 @@
+-- +goose Up
+-- can_view_chirps_of is the one place that decides whose chirps a viewer
+-- sees. Everyone sees their own. Nobody else sees those of suspended or
+-- shadow-banned authors, of authors they block or who block them, or of
+-- private authors they do not follow. Anonymous viewers pass uuid.Nil.
+-- +goose StatementBegin
+CREATE FUNCTION can_view_chirps_of(author UUID, viewer UUID) RETURNS BOOLEAN AS $$
+	SELECT EXISTS (
+		SELECT 1 FROM users
+		WHERE users.id = author AND (
+			users.id = viewer OR (
+				users.shadow_banned_at IS NULL
+				AND (users.suspended_at IS NULL OR users.suspended_until <= NOW())
+				AND NOT EXISTS (
+					SELECT 1 FROM blocks
+					WHERE (blocks.blocker_id = viewer AND blocks.blocked_id = users.id)
+					OR (blocks.blocker_id = users.id AND blocks.blocked_id = viewer)
+				)
+				AND (NOT users.is_private OR EXISTS (
+					SELECT 1 FROM follows
+					WHERE follows.follower_id = viewer AND follows.followee_id = users.id AND follows.status = 'approved'
+				))
+			)
+		)
+	);
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION can_view_chirps_of(UUID, UUID);
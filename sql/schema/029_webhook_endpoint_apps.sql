@@ -0,0 +1,8 @@
+-- +goose Up
+-- Webhook endpoints belong to a registered app, an OAuth client, and go
+-- away with it. Endpoints created before that stop receiving events.
+ALTER TABLE webhook_endpoints ADD COLUMN client_id TEXT REFERENCES oauth_clients(id) ON DELETE CASCADE;
+UPDATE webhook_endpoints SET disabled_at = NOW(), updated_at = NOW() WHERE client_id IS NULL AND disabled_at IS NULL;
+
+-- +goose Down
+ALTER TABLE webhook_endpoints DROP COLUMN client_id;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Failed events wait before the next attempt, and claimed events are leased
+-- by pushing next_attempt_at past the time the relay needs for them.
+ALTER TABLE outbox ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox(next_attempt_at) WHERE dispatched_at IS NULL;
+
+-- +goose Down
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox(occurred_at) WHERE dispatched_at IS NULL;
+ALTER TABLE outbox DROP COLUMN next_attempt_at;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- A reply keeps pointing at nothing once its parent is deleted. Handles are
+-- stored lowercased, so @Alice and @alice mention the same user.
+ALTER TABLE chirps ADD COLUMN reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN handle TEXT UNIQUE;
+
+CREATE TABLE chirp_likes(
+	chirp_id UUID NOT NULL,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY(chirp_id, user_id),
+    FOREIGN KEY(chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+CREATE TABLE rechirps(
+	chirp_id UUID NOT NULL,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY(chirp_id, user_id),
+    FOREIGN KEY(chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    FOREIGN KEY(user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+	);
+
+-- +goose Down
+DROP TABLE rechirps;
+DROP TABLE chirp_likes;
+ALTER TABLE users DROP COLUMN handle;
+ALTER TABLE chirps DROP COLUMN reply_to_id;
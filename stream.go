@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/google/uuid"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+)
+
+// streamSink is the outbox sink that feeds chirp events into the live
+// stream broker.
+func (cfg *apiConfig) streamSink(ctx context.Context, event events.Event) error {
+	if event.Type != events.ChirpCreated && event.Type != events.ChirpDeleted {
+		return nil
+	}
+	chirp := chirpEventPayload{}
+	err := json.Unmarshal(event.Payload, &chirp)
+	if err != nil {
+		return err
+	}
+	// Like the listings, only show the chirps of suspended and shadow-banned
+	// users to themselves.
+	var recipient uuid.UUID
+	author, err := cfg.dbQueries.GetUserByID(ctx, chirp.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && userHidden(author) {
+		recipient = author.ID
+	}
+	cfg.broker.Publish(stream.Event{
+		Key:       event.ID.String(),
+		Type:      event.Type,
+		Recipient: recipient,
+		Protected: author.IsPrivate,
+		AuthorID:  chirp.UserID,
+		SubjectID: chirp.ID,
+		Hashtags:  stream.Hashtags(chirp.Body),
+		Data:      event.Payload,
+	})
+	return nil
+}
+
+func (cfg *apiConfig) streamHandler(w http.ResponseWriter, req *http.Request) {
+	filter, err := streamFilter(req)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("last_event_id")
+	}
+
+	rc := http.NewResponseController(w)
+	sub, replay, complete := cfg.broker.Subscribe(filter, lastEventID)
+	defer cfg.broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+
+	write := func(frame string) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		_, err := w.Write([]byte(frame))
+		if err == nil {
+			err = rc.Flush()
+		}
+		return err == nil
+	}
+
+	if !write("retry: 3000\n\n") {
+		return
+	}
+	// The replay buffer did not reach back far enough, or Last-Event-ID is
+	// from before a restart, the client has to refetch GET /api/chirps before
+	// relying on the stream again.
+	if !complete && !write("event: resync\ndata: {}\n\n") {
+		return
+	}
+	for _, event := range replay {
+		if !write(formatStreamEvent(event)) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-cfg.shuttingDown:
+			return
+		case <-sub.Done():
+			// Dropped for falling behind; the client reconnects with
+			// Last-Event-ID and catches up from the replay buffer.
+			return
+		case event := <-sub.C:
+			if !write(formatStreamEvent(event)) {
+				return
+			}
+		case <-heartbeat.C:
+			if !write(": heartbeat\n\n") {
+				return
+			}
+		}
+	}
+}
+
+// streamFilter builds the subscription filter from the author_id and hashtag
+// query parameters. Without either the stream is global. The stream is
+// anonymous, so it never carries the chirps of private users.
+func streamFilter(req *http.Request) (stream.Filter, error) {
+	var authorID uuid.UUID
+	if authorStr := req.URL.Query().Get("author_id"); authorStr != "" {
+		parsed, err := uuid.Parse(authorStr)
+		if err != nil {
+			return nil, err
+		}
+		authorID = parsed
+	}
+	hashtag := strings.ToLower(strings.TrimPrefix(req.URL.Query().Get("hashtag"), "#"))
+
+	return func(event stream.Event) bool {
+		if event.Recipient != uuid.Nil || event.Protected {
+			return false
+		}
+		if authorID != uuid.Nil && event.AuthorID != authorID {
+			return false
+		}
+		if hashtag == "" {
+			return true
+		}
+		for _, tag := range event.Hashtags {
+			if tag == hashtag {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func formatStreamEvent(event stream.Event) string {
+	return fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
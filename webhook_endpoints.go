@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+type resWebhookEndpoint struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	URL          string     `json:"url"`
+	EventTypes   []string   `json:"event_types"`
+	ClientID     string     `json:"client_id"`
+	FailureCount int32      `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	Secret       string     `json:"secret,omitempty"`
+}
+
+func toResWebhookEndpoint(endpoint database.WebhookEndpoint) resWebhookEndpoint {
+	res := resWebhookEndpoint{
+		ID:           endpoint.ID,
+		CreatedAt:    endpoint.CreatedAt,
+		UpdatedAt:    endpoint.UpdatedAt,
+		URL:          endpoint.Url,
+		EventTypes:   endpoint.EventTypes,
+		ClientID:     endpoint.ClientID.String,
+		FailureCount: endpoint.FailureCount,
+	}
+	if endpoint.DisabledAt.Valid {
+		res.DisabledAt = &endpoint.DisabledAt.Time
+	}
+	return res
+}
+
+// createWebhookEndpointHandler subscribes a registered app to events. The
+// endpoint belongs to one of the caller's OAuth clients and is deleted with
+// it; plain accounts cannot receive webhooks.
+func (cfg *apiConfig) createWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	type req_body struct {
+		ClientID   string   `json:"client_id"`
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+	r_body := req_body{}
+	r_data, err := io.ReadAll(req.Body)
+	defer req.Body.Close()
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(r_data, &r_body)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if r_body.ClientID == "" {
+		w.WriteHeader(400)
+		w.Write([]byte("client_id of a registered app is required"))
+		return
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(req.Context(), r_body.ClientID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && client.UserID != userID {
+		w.WriteHeader(404)
+		w.Write([]byte("App not found"))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	parsedURL, err := webhooks.ValidateURL(req.Context(), r_body.URL, cfg.platform == "dev")
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(r_body.EventTypes) == 0 {
+		w.WriteHeader(400)
+		w.Write([]byte("at least one event type is required"))
+		return
+	}
+	for _, eventType := range r_body.EventTypes {
+		if !webhooks.ValidEventType(eventType) {
+			w.WriteHeader(400)
+			w.Write([]byte("unknown event type " + eventType))
+			return
+		}
+	}
+
+	secret, err := webhooks.MakeSecret()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpoint, err := cfg.dbQueries.CreateWebhookEndpoint(req.Context(), database.CreateWebhookEndpointParams{
+		Url:        parsedURL.String(),
+		Secret:     secret,
+		EventTypes: r_body.EventTypes,
+		ClientID:   sql.NullString{String: client.ID, Valid: true},
+		UserID:     userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// The signing secret is only ever returned on creation.
+	res := toResWebhookEndpoint(endpoint)
+	res.Secret = endpoint.Secret
+	response_json, _ := json.Marshal(res)
+	w.WriteHeader(201)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) listWebhookEndpointsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpoints, err := cfg.dbQueries.ListWebhookEndpointsForUser(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	res_endpoints := []resWebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		res_endpoints = append(res_endpoints, toResWebhookEndpoint(endpoint))
+	}
+	response_json, _ := json.Marshal(res_endpoints)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) deleteWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpointID, err := uuid.Parse(req.PathValue("webhookID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	deleted, err := cfg.dbQueries.DeleteWebhookEndpoint(req.Context(), database.DeleteWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) enableWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpointID, err := uuid.Parse(req.PathValue("webhookID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	updated, err := cfg.dbQueries.EnableWebhookEndpoint(req.Context(), database.EnableWebhookEndpointParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if updated == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) listWebhookDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpointID, err := uuid.Parse(req.PathValue("webhookID"))
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	endpoints, err := cfg.dbQueries.ListWebhookEndpointsForUser(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	owned := false
+	for _, endpoint := range endpoints {
+		if endpoint.ID == endpointID {
+			owned = true
+		}
+	}
+	if !owned {
+		w.WriteHeader(404)
+		return
+	}
+
+	deliveries, err := cfg.dbQueries.ListWebhookDeliveriesForEndpoint(req.Context(), database.ListWebhookDeliveriesForEndpointParams{
+		EndpointID: endpointID,
+		Limit:      50,
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	type resDelivery struct {
+		ID            uuid.UUID       `json:"id"`
+		EventID       uuid.UUID       `json:"event_id"`
+		EventType     string          `json:"event_type"`
+		Payload       json.RawMessage `json:"payload"`
+		Status        string          `json:"status"`
+		Attempts      int32           `json:"attempts"`
+		NextAttemptAt time.Time       `json:"next_attempt_at"`
+		CreatedAt     time.Time       `json:"created_at"`
+	}
+	res_deliveries := []resDelivery{}
+	for _, delivery := range deliveries {
+		res_deliveries = append(res_deliveries, resDelivery{
+			ID:            delivery.ID,
+			EventID:       delivery.EventID,
+			EventType:     delivery.EventType,
+			Payload:       delivery.Payload,
+			Status:        delivery.Status,
+			Attempts:      delivery.Attempts,
+			NextAttemptAt: delivery.NextAttemptAt,
+			CreatedAt:     delivery.CreatedAt,
+		})
+	}
+	response_json, _ := json.Marshal(res_deliveries)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+// enqueueWebhook is the outbox sink that queues a domain event for every
+// active endpoint subscribed to its type. The domain event ID is reused as
+// webhook event ID, so a redelivered event is never queued twice.
+func (cfg *apiConfig) enqueueWebhook(ctx context.Context, event events.Event) error {
+	if !webhooks.ValidEventType(event.Type) {
+		return nil
+	}
+	endpoints, err := cfg.dbQueries.ListActiveWebhookEndpointsForEvent(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+	endpoints, err = cfg.endpointsAllowedToSee(ctx, event, endpoints)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(webhooks.Event{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.OccurredAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		err = cfg.dbQueries.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Payload:    payload,
+			EndpointID: endpoint.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpointsAllowedToSee drops the endpoints whose owners may not see the
+// event. User events only go to the user's own endpoints and to admins, chirp
+// events only to owners who may see the chirp, e.g. not if its author is
+// private.
+func (cfg *apiConfig) endpointsAllowedToSee(ctx context.Context, event events.Event, endpoints []database.WebhookEndpoint) ([]database.WebhookEndpoint, error) {
+	if event.Type == events.UserCreated || event.Type == events.UserUpgraded {
+		allowed := []database.WebhookEndpoint{}
+		for _, endpoint := range endpoints {
+			if endpoint.UserID == event.AggregateID {
+				allowed = append(allowed, endpoint)
+				continue
+			}
+			owner, err := cfg.dbQueries.GetUserByID(ctx, endpoint.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if owner.Role == auth.RoleAdmin {
+				allowed = append(allowed, endpoint)
+			}
+		}
+		return allowed, nil
+	}
+	if event.Type != events.ChirpCreated && event.Type != events.ChirpDeleted {
+		return endpoints, nil
+	}
+	chirp := chirpEventPayload{}
+	err := json.Unmarshal(event.Payload, &chirp)
+	if err != nil {
+		return nil, err
+	}
+	allowed := []database.WebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		visible, err := cfg.dbQueries.CanViewChirpsOf(ctx, database.CanViewChirpsOfParams{
+			AuthorID: chirp.UserID,
+			ViewerID: endpoint.UserID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			allowed = append(allowed, endpoint)
+		}
+	}
+	return allowed, nil
+}
+
+// webhookStore backs the delivery worker with Postgres.
+type webhookStore struct {
+	db *database.Queries
+}
+
+// ClaimDueDeliveries moves the next attempt of the claimed deliveries to
+// lockedUntil, so other workers skip them until then.
+func (s webhookStore) ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lockedUntil time.Time) ([]webhooks.Delivery, error) {
+	rows, err := s.db.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		Now:         now,
+		BatchSize:   int32(limit),
+		LockedUntil: lockedUntil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []webhooks.Delivery{}
+	for _, row := range rows {
+		deliveries = append(deliveries, webhooks.Delivery{
+			ID:         row.ID,
+			EndpointID: row.EndpointID,
+			URL:        row.Url,
+			Secret:     row.Secret,
+			EventType:  row.EventType,
+			Payload:    row.Payload,
+			Attempts:   int(row.Attempts),
+		})
+	}
+	return deliveries, nil
+}
+
+func (s webhookStore) RecordAttempt(ctx context.Context, attempt webhooks.Attempt) error {
+	return s.db.CreateWebhookDeliveryAttempt(ctx, database.CreateWebhookDeliveryAttemptParams{
+		Attempt:     int32(attempt.Number),
+		AttemptedAt: attempt.AttemptedAt,
+		StatusCode:  sql.NullInt32{Int32: int32(attempt.StatusCode), Valid: attempt.StatusCode != 0},
+		Error:       sql.NullString{String: attempt.Error, Valid: attempt.Error != ""},
+		DurationMs:  int32(attempt.Duration.Milliseconds()),
+		DeliveryID:  attempt.DeliveryID,
+	})
+}
+
+func (s webhookStore) MarkDelivered(ctx context.Context, deliveryID uuid.UUID) error {
+	return s.db.MarkWebhookDeliveryDelivered(ctx, deliveryID)
+}
+
+func (s webhookStore) ScheduleRetry(ctx context.Context, deliveryID uuid.UUID, next time.Time) error {
+	return s.db.ScheduleWebhookDeliveryRetry(ctx, database.ScheduleWebhookDeliveryRetryParams{
+		ID:            deliveryID,
+		NextAttemptAt: next,
+	})
+}
+
+func (s webhookStore) MarkFailed(ctx context.Context, deliveryID uuid.UUID) error {
+	return s.db.MarkWebhookDeliveryFailed(ctx, deliveryID)
+}
+
+func (s webhookStore) EndpointFailed(ctx context.Context, endpointID uuid.UUID) (int, error) {
+	failures, err := s.db.IncrementWebhookEndpointFailures(ctx, endpointID)
+	return int(failures), err
+}
+
+func (s webhookStore) EndpointSucceeded(ctx context.Context, endpointID uuid.UUID) error {
+	return s.db.ResetWebhookEndpointFailures(ctx, endpointID)
+}
+
+func (s webhookStore) DisableEndpoint(ctx context.Context, endpointID uuid.UUID) error {
+	return s.db.DisableWebhookEndpoint(ctx, endpointID)
+}
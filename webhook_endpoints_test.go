@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+)
+
+func TestCreateWebhookEndpointRequiresApp(t *testing.T) {
+	cfg := newTestConfig(t)
+	mux := newTestMux(cfg)
+	owner := createTestUser(t, cfg, auth.RoleUser)
+	other := createTestUser(t, cfg, auth.RoleUser)
+	client, err := cfg.dbQueries.CreateOAuthClient(context.Background(), database.CreateOAuthClientParams{
+		ID:           "client_1",
+		Name:         "Integration",
+		RedirectUris: []string{"https://app.example.com/callback"},
+		Scopes:       []string{auth.ScopeChirpsWrite},
+		UserID:       owner.ID,
+	})
+	if err != nil {
+		t.Fatal("failed to create client:", err)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		clientID string
+		want     int
+	}{
+		{"no app", owner.token, "", 400},
+		{"unknown app", owner.token, "client_2", 404},
+		{"app of another user", other.token, client.ID, 404},
+		{"own app", owner.token, client.ID, 201},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]any{
+				"client_id":   c.clientID,
+				"url":         "http://93.184.216.34/hook",
+				"event_types": []string{"chirp.created"},
+			})
+			rec := serve(mux, "POST", "/api/webhooks", c.token, string(body))
+			if rec.Code != c.want {
+				t.Errorf("Expected %d, got %d: %s", c.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/google/uuid"
+)
+
+const (
+	webhookStatusPending   = "pending"
+	webhookStatusProcessed = "processed"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusFailed    = "failed"
+)
+
+// webhookEventLease is how long an event stays claimed by the request
+// processing it. A pending event whose lease ran out was abandoned, e.g. by a
+// crash, and is processed again by the next Polka retry or a replay.
+const webhookEventLease = time.Minute
+
+// webhookEventID derives a stable ID for deliveries that do not carry one, so
+// identical retries of the same payload still collapse onto a single row.
+func webhookEventID(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// processWebhookEvent applies a logged Polka event and records the outcome on
+// its webhook_events row. It is shared by the webhook endpoint and the replay
+// endpoint.
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, event database.WebhookEvent) error {
+	type polkaEvent struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+
+	fail := func(err error) error {
+		markErr := cfg.dbQueries.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{
+			ID:    event.ID,
+			Error: sql.NullString{String: err.Error(), Valid: true},
+		})
+		if markErr != nil {
+			log.Printf("webhook event %s: recording failure %q: %v", event.ID, err, markErr)
+		}
+		return err
+	}
+
+	payload := polkaEvent{}
+	err := json.Unmarshal(event.Payload, &payload)
+	if err != nil {
+		return fail(err)
+	}
+	if payload.Event != "user.upgraded" {
+		return cfg.dbQueries.MarkWebhookEventProcessed(ctx, database.MarkWebhookEventProcessedParams{
+			ID:     event.ID,
+			Status: webhookStatusIgnored,
+		})
+	}
+
+	userUUID, err := uuid.Parse(payload.Data.UserID)
+	if err != nil {
+		return fail(err)
+	}
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		err := q.SubscribeUser(ctx, userUUID)
+		if err != nil {
+			return err
+		}
+		err = recordEvent(ctx, q, events.UserUpgraded, userUUID, map[string]uuid.UUID{
+			"user_id": userUUID,
+		})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(ctx, q, auditEntry{
+			Action:     auditSubscriptionChanged,
+			TargetType: auditTargetUser,
+			TargetID:   userUUID.String(),
+			Diff: map[string]any{
+				"is_chirpy_red":    map[string]any{"new": true},
+				"webhook_event_id": event.ID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return q.MarkWebhookEventProcessed(ctx, database.MarkWebhookEventProcessedParams{
+			ID:     event.ID,
+			Status: webhookStatusProcessed,
+		})
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+type resWebhookEvent struct {
+	ID          string          `json:"id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+}
+
+func toResWebhookEvent(event database.WebhookEvent) resWebhookEvent {
+	res := resWebhookEvent{
+		ID:         event.ID,
+		EventType:  event.EventType,
+		Payload:    event.Payload,
+		ReceivedAt: event.ReceivedAt,
+		Status:     event.Status,
+		Error:      event.Error.String,
+	}
+	if event.ProcessedAt.Valid {
+		res.ProcessedAt = &event.ProcessedAt.Time
+	}
+	return res
+}
+
+func (cfg *apiConfig) listWebhookEventsHandler(w http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get("status")
+	limit := int32(50)
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 500 {
+			w.WriteHeader(400)
+			w.Write([]byte("limit must be between 1 and 500"))
+			return
+		}
+		limit = int32(parsed)
+	}
+
+	var events []database.WebhookEvent
+	var err error
+	if status == "" {
+		events, err = cfg.dbQueries.ListWebhookEvents(req.Context(), limit)
+	} else {
+		events, err = cfg.dbQueries.ListWebhookEventsByStatus(req.Context(), database.ListWebhookEventsByStatusParams{
+			Status: status,
+			Limit:  limit,
+		})
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	res_events := []resWebhookEvent{}
+	for _, event := range events {
+		res_events = append(res_events, toResWebhookEvent(event))
+	}
+	response_json, _ := json.Marshal(res_events)
+	w.WriteHeader(200)
+	w.Write(response_json)
+}
+
+func (cfg *apiConfig) replayWebhookEventHandler(w http.ResponseWriter, req *http.Request) {
+	eventID := req.PathValue("eventID")
+	event, err := cfg.dbQueries.GetWebhookEvent(req.Context(), eventID)
+	if err != nil {
+		w.WriteHeader(404)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	claimed, err := cfg.dbQueries.ClaimWebhookEvent(req.Context(), database.ClaimWebhookEventParams{
+		ID:          eventID,
+		LockedUntil: time.Now().Add(webhookEventLease),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(409)
+		w.Write([]byte(fmt.Sprintf("Only failed and abandoned pending events can be replayed, event is %s", event.Status)))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	// The claim turns the event pending again; the audit entry shows the
+	// status it was replayed from.
+	oldStatus := event.Status
+	event = claimed
+
+	processErr := cfg.processWebhookEvent(req.Context(), event)
+	event, err = cfg.dbQueries.GetWebhookEvent(req.Context(), eventID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	claims, _ := cfg.authenticate(req)
+	cfg.recordAuditBestEffort(req.Context(), auditEntry{
+		Action:     auditWebhookReplayed,
+		ActorID:    claims.UserID,
+		TargetType: auditTargetWebhook,
+		TargetID:   event.ID,
+		Diff:       map[string]any{"status": auditChange(oldStatus, event.Status)},
+	})
+
+	response_json, _ := json.Marshal(toResWebhookEvent(event))
+	if processErr != nil {
+		w.WriteHeader(422)
+	} else {
+		w.WriteHeader(200)
+	}
+	w.Write(response_json)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/database"
+)
+
+func TestClaimWebhookEventOnce(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	_, err := cfg.dbQueries.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{
+		ID:          "evt_1",
+		EventType:   "user.upgraded",
+		Payload:     []byte(`{"event":"user.upgraded","data":{"user_id":"not-a-uuid"}}`),
+		LockedUntil: time.Now().Add(webhookEventLease),
+	})
+	if err != nil {
+		t.Fatal("failed to create event:", err)
+	}
+	err = cfg.dbQueries.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{
+		ID:    "evt_1",
+		Error: sql.NullString{String: "boom", Valid: true},
+	})
+	if err != nil {
+		t.Fatal("failed to mark event failed:", err)
+	}
+
+	claim := func() error {
+		_, err := cfg.dbQueries.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+			ID:          "evt_1",
+			LockedUntil: time.Now().Add(webhookEventLease),
+		})
+		return err
+	}
+	err = claim()
+	if err != nil {
+		t.Fatal("Expected the failed event to be claimable:", err)
+	}
+	err = claim()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected a second claim to be refused, got %v", err)
+	}
+	event, err := cfg.dbQueries.GetWebhookEvent(ctx, "evt_1")
+	if err != nil {
+		t.Fatal("failed to get event:", err)
+	}
+	if event.Status != webhookStatusPending {
+		t.Errorf("Expected a claimed event to be %s, got %s", webhookStatusPending, event.Status)
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/auth"
+	"github.com/Lunnaris01/bootdev_servers/internal/events"
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/Lunnaris01/bootdev_servers/internal/ws"
+	"github.com/google/uuid"
+)
+
+const (
+	wsPingInterval     = 30 * time.Second
+	wsReadTimeout      = 2 * wsPingInterval
+	wsSendQueueSize    = 64
+	wsReauthWarning    = time.Minute
+	wsRelationsRefresh = time.Minute
+
+	// streamEventRelationsChanged tells the connections of the recipient that
+	// a follow, block or mute involving them changed.
+	streamEventRelationsChanged = "relations_changed"
+
+	// wsCloseTokenExpired is sent when the access token expired without the
+	// client re-authenticating. Codes 4000-4999 are reserved for apps.
+	wsCloseTokenExpired = 4001
+
+	wsChannelHome          = "home"
+	wsChannelNotifications = "notifications"
+	wsChannelThread        = "thread"
+)
+
+// wsHub tracks open WebSocket connections. Hijacked connections are not
+// seen by http.Server.Shutdown, so the hub drains them itself.
+type wsHub struct {
+	mu       sync.Mutex
+	clients  map[*wsClient]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{clients: map[*wsClient]struct{}{}}
+}
+
+func (h *wsHub) add(client *wsClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return false
+	}
+	h.clients[client] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+func (h *wsHub) remove(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		h.wg.Done()
+	}
+}
+
+// Drain asks every client to go away and waits until they disconnected or
+// ctx expires.
+func (h *wsHub) Drain(ctx context.Context) {
+	h.mu.Lock()
+	h.draining = true
+	for client := range h.clients {
+		client.shutdown(ws.CloseGoingAway, "server shutting down")
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.mu.Lock()
+		for client := range h.clients {
+			client.conn.Close()
+		}
+		h.mu.Unlock()
+	}
+}
+
+type wsClient struct {
+	cfg    *apiConfig
+	conn   *ws.Conn
+	userID uuid.UUID
+	send   chan []byte
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	channels  map[string]bool
+	// readsAccount is set when the token carries users:read, which the
+	// notifications channel needs.
+	readsAccount bool
+
+	// Only touched by forward. followees only holds approved follows,
+	// blocked the users blocked by or blocking the client.
+	followees       map[uuid.UUID]bool
+	blocked         map[uuid.UUID]bool
+	muted           map[uuid.UUID]bool
+	relationsLoaded time.Time
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+type wsInbound struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Token   string `json:"token"`
+}
+
+type wsOutbound struct {
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+// wsTokenFromRequest reads the access token from the Authorization header or,
+// for browsers that cannot set headers on WebSocket requests, from the
+// access_token query parameter.
+func wsTokenFromRequest(req *http.Request) (string, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err == nil {
+		return token, nil
+	}
+	if token := req.URL.Query().Get("access_token"); token != "" {
+		return token, nil
+	}
+	return "", err
+}
+
+func (cfg *apiConfig) websocketHandler(w http.ResponseWriter, req *http.Request) {
+	token, err := wsTokenFromRequest(req)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	claims, err := cfg.jwtKeys.ValidateJWT(token)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	userID := claims.UserID
+	expiresAt := claims.ExpiresAt.Time
+	err = cfg.checkNotSuspended(req.Context(), userID)
+	if err != nil {
+		w.WriteHeader(401)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	conn, err := ws.Upgrade(w, req)
+	if err != nil {
+		return
+	}
+	client := &wsClient{
+		cfg:          cfg,
+		conn:         conn,
+		userID:       userID,
+		send:         make(chan []byte, wsSendQueueSize),
+		expiresAt:    expiresAt,
+		readsAccount: claims.HasScope(auth.ScopeUsersRead),
+		channels:     map[string]bool{},
+		closing:      make(chan struct{}),
+	}
+	if !cfg.wsHub.add(client) {
+		conn.WriteClose(ws.CloseGoingAway, "server shutting down")
+		conn.Close()
+		return
+	}
+	defer cfg.wsHub.remove(client)
+	defer conn.Close()
+
+	sub, _, _ := cfg.broker.Subscribe(func(event stream.Event) bool {
+		return event.Recipient == uuid.Nil || event.Recipient == userID
+	}, "")
+	defer cfg.broker.Unsubscribe(sub)
+
+	go client.writeLoop()
+	go client.forward(sub)
+	client.readLoop()
+}
+
+// shutdown sends a close frame once and stops the writer. The read loop ends
+// when the peer answers or the connection is closed.
+func (c *wsClient) shutdown(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.conn.WriteClose(code, reason)
+		// Give the peer a moment to complete the closing handshake.
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	})
+}
+
+func (c *wsClient) enqueue(message wsOutbound) {
+	data, _ := json.Marshal(message)
+	select {
+	case c.send <- data:
+	case <-c.closing:
+	default:
+		c.shutdown(ws.CloseTryAgainLater, "send queue full")
+	}
+}
+
+func (c *wsClient) readLoop() {
+	c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	c.conn.PongHandler = func([]byte) {
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	}
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			var closeErr *ws.CloseError
+			if !errors.As(err, &closeErr) {
+				c.shutdown(ws.CloseGoingAway, "")
+			}
+			return
+		}
+		select {
+		case <-c.closing:
+			continue
+		default:
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+
+		inbound := wsInbound{}
+		err = json.Unmarshal(message, &inbound)
+		if err != nil {
+			c.enqueue(wsOutbound{Type: "error", Message: "invalid JSON"})
+			continue
+		}
+		c.handle(inbound)
+	}
+}
+
+func (c *wsClient) handle(inbound wsInbound) {
+	switch inbound.Type {
+	case "subscribe", "unsubscribe":
+		channel, err := wsChannelKey(inbound.Channel, inbound.ID)
+		if err != nil {
+			c.enqueue(wsOutbound{Type: "error", Channel: inbound.Channel, Message: err.Error()})
+			return
+		}
+		c.mu.Lock()
+		if inbound.Type == "subscribe" && channel == wsChannelNotifications && !c.readsAccount {
+			c.mu.Unlock()
+			c.enqueue(wsOutbound{Type: "error", Channel: inbound.Channel, Message: "token lacks the " + auth.ScopeUsersRead + " scope"})
+			return
+		}
+		if inbound.Type == "subscribe" {
+			c.channels[channel] = true
+		} else {
+			delete(c.channels, channel)
+		}
+		c.mu.Unlock()
+		c.enqueue(wsOutbound{Type: inbound.Type + "d", Channel: inbound.Channel, ID: inbound.ID})
+	case "auth":
+		claims, err := c.cfg.jwtKeys.ValidateJWT(inbound.Token)
+		if err != nil || claims.UserID != c.userID {
+			c.enqueue(wsOutbound{Type: "error", Message: "invalid token"})
+			return
+		}
+		expiresAt := claims.ExpiresAt.Time
+		c.mu.Lock()
+		c.expiresAt = expiresAt
+		c.readsAccount = claims.HasScope(auth.ScopeUsersRead)
+		c.mu.Unlock()
+		c.enqueue(wsOutbound{Type: "authenticated", ExpiresAt: &expiresAt})
+	default:
+		c.enqueue(wsOutbound{Type: "error", Message: "unknown message type " + inbound.Type})
+	}
+}
+
+func wsChannelKey(channel, id string) (string, error) {
+	switch channel {
+	case wsChannelHome, wsChannelNotifications:
+		return channel, nil
+	case wsChannelThread:
+		chirpID, err := uuid.Parse(id)
+		if err != nil {
+			return "", errors.New("thread channel requires a chirp id")
+		}
+		return wsChannelThread + ":" + chirpID.String(), nil
+	}
+	return "", errors.New("unknown channel " + channel)
+}
+
+// writeLoop owns all writes except close frames: queued messages, pings and
+// the re-authentication deadline.
+func (c *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	expiry := time.NewTimer(0)
+	defer expiry.Stop()
+	warned := false
+
+	for {
+		select {
+		case <-c.closing:
+			return
+		case data := <-c.send:
+			err := c.conn.WriteMessage(ws.OpText, data)
+			if err != nil {
+				c.shutdown(ws.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			err := c.conn.WriteMessage(ws.OpPing, nil)
+			if err != nil {
+				c.shutdown(ws.CloseGoingAway, "")
+				return
+			}
+		case <-expiry.C:
+			c.mu.Lock()
+			expiresAt := c.expiresAt
+			c.mu.Unlock()
+			untilExpiry := time.Until(expiresAt)
+			switch {
+			case untilExpiry <= 0:
+				c.shutdown(wsCloseTokenExpired, "token expired")
+				return
+			case untilExpiry <= wsReauthWarning:
+				if !warned {
+					warned = true
+					c.enqueue(wsOutbound{Type: "reauth_required", ExpiresAt: &expiresAt})
+				}
+				expiry.Reset(untilExpiry)
+			default:
+				warned = false
+				expiry.Reset(untilExpiry - wsReauthWarning)
+			}
+		}
+	}
+}
+
+// forward routes broker events to the channels the client subscribed to.
+func (c *wsClient) forward(sub *stream.Subscription) {
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-sub.Done():
+			c.shutdown(ws.CloseTryAgainLater, "falling behind")
+			return
+		case event := <-sub.C:
+			for _, channel := range c.channelsFor(event) {
+				name, id, _ := strings.Cut(channel, ":")
+				c.enqueue(wsOutbound{
+					Type:    "event",
+					Channel: name,
+					ID:      id,
+					Event:   event.Type,
+					Data:    event.Data,
+				})
+			}
+		}
+	}
+}
+
+func (c *wsClient) channelsFor(event stream.Event) []string {
+	c.mu.Lock()
+	subscribed := map[string]bool{}
+	for channel := range c.channels {
+		subscribed[channel] = true
+	}
+	readsAccount := c.readsAccount
+	c.mu.Unlock()
+
+	matched := []string{}
+	if event.Type == streamEventRelationsChanged {
+		if event.Recipient == c.userID {
+			c.relationsLoaded = time.Time{}
+		}
+		return matched
+	}
+	if event.Type == streamEventNotification {
+		if subscribed[wsChannelNotifications] && readsAccount && event.Recipient == c.userID {
+			matched = append(matched, wsChannelNotifications)
+		}
+		return matched
+	}
+	if event.Type != events.ChirpCreated && event.Type != events.ChirpDeleted {
+		return matched
+	}
+	c.loadRelations()
+	if c.blocked[event.AuthorID] {
+		return matched
+	}
+	if event.Protected && event.AuthorID != c.userID && !c.followees[event.AuthorID] {
+		return matched
+	}
+	if subscribed[wsChannelHome] && (event.AuthorID == c.userID || (c.followees[event.AuthorID] && !c.muted[event.AuthorID])) {
+		matched = append(matched, wsChannelHome)
+	}
+	thread := wsChannelThread + ":" + event.SubjectID.String()
+	if subscribed[thread] {
+		matched = append(matched, thread)
+	}
+	return matched
+}
+
+// loadRelations reloads who the client follows, blocked and muted when the
+// sets got stale or a relation of the client changed. On errors the old sets are kept and loading is retried with
+// the next event.
+func (c *wsClient) loadRelations() {
+	if time.Since(c.relationsLoaded) <= wsRelationsRefresh {
+		return
+	}
+	ctx := context.Background()
+	followees, err := c.cfg.dbQueries.ListFolloweeIDs(ctx, c.userID)
+	if err != nil {
+		log.Printf("websocket: loading followees of %s: %v", c.userID, err)
+		return
+	}
+	blocked, err := c.cfg.dbQueries.ListBlockedEitherWayIDs(ctx, c.userID)
+	if err != nil {
+		log.Printf("websocket: loading blocks of %s: %v", c.userID, err)
+		return
+	}
+	muted, err := c.cfg.dbQueries.ListMutedIDs(ctx, c.userID)
+	if err != nil {
+		log.Printf("websocket: loading mutes of %s: %v", c.userID, err)
+		return
+	}
+	c.followees = idSet(followees)
+	c.blocked = idSet(blocked)
+	c.muted = idSet(muted)
+	c.relationsLoaded = time.Now()
+}
+
+// relationsChanged makes the open WebSocket connections of userIDs reload
+// their relations with the next event, so a new block or mute applies right
+// away rather than within wsRelationsRefresh.
+func (cfg *apiConfig) relationsChanged(userIDs ...uuid.UUID) {
+	for _, userID := range userIDs {
+		cfg.broker.Publish(stream.Event{
+			Type:      streamEventRelationsChanged,
+			Recipient: userID,
+		})
+	}
+}
+
+func idSet(ids []uuid.UUID) map[uuid.UUID]bool {
+	set := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
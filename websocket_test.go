@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Lunnaris01/bootdev_servers/internal/stream"
+	"github.com/google/uuid"
+)
+
+func TestRelationsChangedReloadsRelations(t *testing.T) {
+	cfg := &apiConfig{broker: stream.NewBroker(10, 10)}
+	client := &wsClient{
+		cfg:             cfg,
+		userID:          uuid.New(),
+		channels:        map[string]bool{wsChannelHome: true},
+		relationsLoaded: time.Now(),
+	}
+	sub, _, _ := cfg.broker.Subscribe(nil, "")
+	defer cfg.broker.Unsubscribe(sub)
+
+	cfg.relationsChanged(uuid.New())
+	if channels := client.channelsFor(<-sub.C); len(channels) != 0 {
+		t.Errorf("Expected relation changes not to be forwarded, got %v", channels)
+	}
+	if client.relationsLoaded.IsZero() {
+		t.Errorf("Expected the relations of other users to leave the client alone")
+	}
+
+	cfg.relationsChanged(client.userID)
+	if channels := client.channelsFor(<-sub.C); len(channels) != 0 {
+		t.Errorf("Expected relation changes not to be forwarded, got %v", channels)
+	}
+	if !client.relationsLoaded.IsZero() {
+		t.Errorf("Expected the client to reload its relations with the next event")
+	}
+}